@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// certCovers reports whether a certificate issued for names is valid for
+// host. A wildcard name such as `*.example.com` covers exactly one extra
+// label, so it matches `www.example.com` but not `example.com` or
+// `a.b.example.com`.
+func certCovers(names []string, host string) bool {
+	for _, name := range names {
+		if name == host {
+			return true
+		}
+		if strings.HasPrefix(name, "*.") {
+			i := strings.Index(host, ".")
+			if i > 0 && host[i+1:] == name[2:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uncoveredAliases returns the aliases that a certificate issued for names
+// is not valid for, in order.
+func uncoveredAliases(names, aliases []string) []string {
+	uncovered := []string{}
+	for _, alias := range aliases {
+		if !certCovers(names, alias) {
+			uncovered = append(uncovered, alias)
+		}
+	}
+	return uncovered
+}
+
+// certificateDNSNames returns the DNS names of the first certificate in the
+// PEM encoded body, which are the domain name and SANs of a certificate
+// issued by ACM.
+func certificateDNSNames(body string) ([]string, error) {
+	block, _ := pem.Decode([]byte(body))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return cert.DNSNames, nil
+}
+
+// ownCertificate reports whether a certificate with the tags certTags was
+// issued by the stack, which tags it with every tag in stackTags.
+func ownCertificate(certTags, stackTags map[string]string) bool {
+	for k, v := range stackTags {
+		if certTags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// cloudfrontCNAME looks up host in DNS and returns the CloudFront domain
+// name it is a CNAME to, or "" when it is not one. Alias records are not
+// CNAMEs, so the distributions this program points records at are never
+// returned. Lookup failures other than a missing name are returned as a
+// warning, as the host can not be checked.
+//
+// This is a DNS-only heuristic. It does not look up which distribution
+// claims host as an alias, so it misses an alias attached to another
+// distribution whose DNS does not point there, and reports a CNAME left
+// behind after the alias was removed.
+func cloudfrontCNAME(host string) (target string, warning string) {
+	cname, err := net.LookupCNAME(host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", ""
+		}
+		return "", fmt.Sprintf("%s could not be checked: %v", host, err)
+	}
+	cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+	if !strings.HasSuffix(cname, ".cloudfront.net") {
+		return "", ""
+	}
+	return cname, ""
+}
+
+// checkValidationRecord looks up the validation CNAME name in DNS and
+// returns an error when it already points somewhere other than value, the
+// target ACM expects. A missing record, or one with the expected value,
+// can safely be created or overwritten. Lookup failures other than a
+// missing name are returned as a warning, as the record can not be
+// checked.
+func checkValidationRecord(name, value string) (warning string, err error) {
+	target, err := net.LookupCNAME(name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", nil
+		}
+		return fmt.Sprintf("validation record %s could not be checked: %v", name, err), nil
+	}
+	normalize := func(s string) string {
+		return strings.ToLower(strings.TrimSuffix(s, "."))
+	}
+	if normalize(target) == normalize(name) || normalize(target) == normalize(value) {
+		return "", nil
+	}
+	return "", fmt.Errorf("validation record %s already exists and points to %s instead of %s, remove it or correct it", normalize(name), normalize(target), normalize(value))
+}
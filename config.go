@@ -0,0 +1,1979 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HostRootObject stores the default root object and origin path used by
+// the distribution that serves a single hostname.
+type HostRootObject struct {
+	RootObject string `json:"rootObject"`
+	OriginPath string `json:"originPath"`
+}
+
+// RealtimeLogs stores the settings for CloudFront real-time logs.
+type RealtimeLogs struct {
+	Enabled      bool     `json:"enabled"`
+	StreamArn    string   `json:"streamArn"`
+	SamplingRate int      `json:"samplingRate"`
+	Fields       []string `json:"fields"`
+}
+
+// defaultRealtimeLogFields are the fields sent to the real-time log stream
+// when `realtimeLogs.fields` is not configured.
+var defaultRealtimeLogFields = []string{
+	"timestamp",
+	"c-ip",
+	"cs-method",
+	"cs-host",
+	"cs-uri-stem",
+	"sc-status",
+	"cs-user-agent",
+	"x-edge-location",
+	"x-edge-result-type",
+}
+
+// ErrorResponse stores how CloudFront presents a single HTTP error code.
+type ErrorResponse struct {
+	Page         string `json:"page"`
+	ResponseCode int    `json:"responseCode"`
+	Ttl          *int   `json:"ttl"`
+}
+
+// errorCodes are the HTTP status codes CloudFront allows a custom error
+// response for.
+var errorCodes = []int{400, 403, 404, 405, 414, 416, 500, 501, 502, 503, 504}
+
+// defaultExcludePatterns are the files never uploaded when
+// `excludePatterns` is not configured.
+var defaultExcludePatterns = []string{".DS_Store", "Thumbs.db"}
+
+// CleanUrlKeys stores whether HTML pages are uploaded as directory
+// indexes, and whether their original key is kept as a redirect page.
+type CleanUrlKeys struct {
+	Enabled  bool   `json:"enabled"`
+	Original string `json:"original"`
+}
+
+// GzipAssets stores the settings for compressing text assets at upload.
+type GzipAssets struct {
+	Enabled    bool     `json:"enabled"`
+	MinSize    int64    `json:"minSize"`
+	Extensions []string `json:"extensions"`
+}
+
+// defaultGzipExtensions are the file extensions compressed when
+// `gzipAssets.extensions` is not configured.
+var defaultGzipExtensions = []string{".html", ".css", ".js", ".json", ".svg", ".txt", ".xml"}
+
+// compressedExtensions are formats that are already compressed and gain
+// nothing from gzip.
+var compressedExtensions = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif",
+	".mp3", ".mp4", ".webm", ".woff", ".woff2",
+	".gz", ".br", ".zip",
+}
+
+// Cors stores the settings for Cross-Origin Resource Sharing.
+type Cors struct {
+	Enabled        bool     `json:"enabled"`
+	AllowedOrigins []string `json:"allowedOrigins"`
+	PreflightTtl   int      `json:"preflightTtl"`
+}
+
+// priceClasses are the CloudFront price classes, from the cheapest to the
+// widest edge coverage:
+//
+//   - PriceClass_100: North America, Europe and Israel.
+//   - PriceClass_200: adds Asia, the Middle East and Africa.
+//   - PriceClass_All: every edge location, including South America and Oceania.
+var priceClasses = []string{"PriceClass_100", "PriceClass_200", "PriceClass_All"}
+
+// storageClasses are the S3 storage classes objects can be stored in and
+// still be served directly by CloudFront.
+var storageClasses = []string{"STANDARD", "STANDARD_IA", "ONEZONE_IA", "INTELLIGENT_TIERING", "GLACIER_IR"}
+
+// originShieldRegions are the regions Origin Shield is available in.
+var originShieldRegions = []string{
+	"ap-northeast-1", "ap-northeast-2", "ap-south-1", "ap-southeast-1", "ap-southeast-2",
+	"eu-central-1", "eu-west-1", "eu-west-2", "sa-east-1", "us-east-1", "us-east-2", "us-west-2",
+}
+
+// GeoRestriction stores the countries CloudFront serves the website to.
+type GeoRestriction struct {
+	Type      string   `json:"type"`
+	Locations []string `json:"locations"`
+}
+
+// countryCodeRe matches an ISO 3166-1 alpha-2 country code.
+var countryCodeRe = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ImmutableAssets stores the settings for the cache behavior serving
+// fingerprinted assets.
+type ImmutableAssets struct {
+	Enabled      bool     `json:"enabled"`
+	PathPatterns []string `json:"pathPatterns"`
+	Ttl          int      `json:"ttl"`
+}
+
+// PrivateContent stores the path patterns only served to viewers with a
+// CloudFront signed URL or signed cookies, and the key groups trusted to
+// sign them.
+type PrivateContent struct {
+	Enabled      bool     `json:"enabled"`
+	PathPatterns []string `json:"pathPatterns"`
+	KeyGroupIds  []string `json:"keyGroupIds"`
+	PublicKey    string   `json:"publicKey"`
+}
+
+// ObjectLock stores the default retention applied to every object
+// version written to an Object Lock enabled bucket.
+type ObjectLock struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode"`
+	Days    int    `json:"days"`
+}
+
+// IntelligentTiering stores the days after which objects in the
+// INTELLIGENT_TIERING storage class under Prefix, or the whole bucket,
+// move to the archive access tiers.
+type IntelligentTiering struct {
+	Enabled               bool   `json:"enabled"`
+	Prefix                string `json:"prefix"`
+	ArchiveAccessDays     int    `json:"archiveAccessDays"`
+	DeepArchiveAccessDays int    `json:"deepArchiveAccessDays"`
+}
+
+// BucketMetrics stores the objects, those under Prefix or the whole
+// bucket, whose requests are published as CloudWatch request metrics.
+type BucketMetrics struct {
+	Enabled bool   `json:"enabled"`
+	Prefix  string `json:"prefix"`
+}
+
+// ApiOrigin stores the custom origin, such as an API Gateway or load
+// balancer, that requests matching PathPattern are routed to.
+type ApiOrigin struct {
+	DomainName           string `json:"domainName"`
+	PathPattern          string `json:"pathPattern"`
+	OriginProtocolPolicy string `json:"originProtocolPolicy"`
+	ReadTimeout          int    `json:"readTimeout"`
+	KeepaliveTimeout     int    `json:"keepaliveTimeout"`
+}
+
+// PreviewOrigin stores the custom origin, such as the preview server of a
+// headless CMS, that draft content under PathPattern is served from.
+type PreviewOrigin struct {
+	DomainName           string `json:"domainName"`
+	PathPattern          string `json:"pathPattern"`
+	OriginProtocolPolicy string `json:"originProtocolPolicy"`
+}
+
+// ContentSecurityPolicy stores the enforced and report-only policies sent
+// through a response headers policy. Both can be set while a new policy is
+// rolled out. ReportUri is added as the report-uri of every policy.
+type ContentSecurityPolicy struct {
+	Policy     string `json:"policy"`
+	ReportOnly string `json:"reportOnly"`
+	ReportUri  string `json:"reportUri"`
+}
+
+// Enabled reports whether any policy is set.
+func (p ContentSecurityPolicy) Enabled() bool {
+	return p.Policy != "" || p.ReportOnly != ""
+}
+
+// header returns the header value of policy, with the report-uri added.
+func (p ContentSecurityPolicy) header(policy string) string {
+	if p.ReportUri == "" {
+		return policy
+	}
+	return fmt.Sprintf("%s; report-uri %s", strings.TrimRight(strings.TrimSpace(policy), ";"), p.ReportUri)
+}
+
+// RoutingPolicy stores the Route53 routing policy of the website records,
+// for setups where several stacks serve the same hostnames. Records of
+// every policy other than simple are told apart by SetIdentifier.
+type RoutingPolicy struct {
+	Type          string `json:"type"`
+	SetIdentifier string `json:"setIdentifier"`
+	Region        string `json:"region"`
+	Continent     string `json:"continent"`
+	Country       string `json:"country"`
+	Subdivision   string `json:"subdivision"`
+	Weight        *int   `json:"weight"`
+}
+
+// RouteOrigin stores an origin that routes can send requests to: a
+// bucket, the website bucket when BucketName is empty, or a custom origin.
+type RouteOrigin struct {
+	Type                 string `json:"type"`
+	BucketName           string `json:"bucketName"`
+	DomainName           string `json:"domainName"`
+	OriginPath           string `json:"originPath"`
+	OriginProtocolPolicy string `json:"originProtocolPolicy"`
+}
+
+// Route stores the origin and cache settings for requests matching
+// PathPattern.
+type Route struct {
+	PathPattern         string `json:"pathPattern"`
+	Origin              string `json:"origin"`
+	CachePolicy         string `json:"cachePolicy"`
+	OriginRequestPolicy string `json:"originRequestPolicy"`
+	Methods             string `json:"methods"`
+
+	cachePolicyId         string
+	originRequestPolicyId string
+}
+
+// Prewarm stores the pages requested through the distribution after a
+// deployment, so the nearest edge has them cached. Without Paths the top
+// level pages of the site are requested, at most Limit of them.
+type Prewarm struct {
+	Enabled bool     `json:"enabled"`
+	Paths   []string `json:"paths"`
+	Limit   int      `json:"limit"`
+}
+
+// ErrorAlarm stores the threshold of the CloudWatch alarm on the 5xx error
+// rate of the distribution, and the SNS topic it notifies.
+type ErrorAlarm struct {
+	Enabled           bool    `json:"enabled"`
+	Threshold         float64 `json:"threshold"`
+	EvaluationPeriods int     `json:"evaluationPeriods"`
+	SnsTopicArn       string  `json:"snsTopicArn"`
+}
+
+// Canonicalize stores which URL normalizations the canonicalize
+// CloudFront Function performs.
+type Canonicalize struct {
+	Lowercase     bool   `json:"lowercase"`
+	TrailingSlash string `json:"trailingSlash"`
+	StripIndex    bool   `json:"stripIndex"`
+}
+
+// Enabled reports whether any normalization is turned on.
+func (c Canonicalize) Enabled() bool {
+	return c.Lowercase || c.TrailingSlash != "" || c.StripIndex
+}
+
+// BasicAuth stores the credentials the basic-auth CloudFront Function
+// asks viewers for.
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RequestId stores the settings of the request-id CloudFront Function.
+type RequestId struct {
+	Enabled bool   `json:"enabled"`
+	Header  string `json:"header"`
+}
+
+// Config stores the optional settings loaded from the stack configuration.
+type Config struct {
+	perHostRootObject map[string]HostRootObject
+	uploadConcurrency int
+	uploadProgress    int
+	minFileCount      int
+	sourceHash        string
+	etagPartSize      int
+	excludePatterns   []string
+	stripPrefix       string
+	cleanUrlKeys      CleanUrlKeys
+	directoryKeys     bool
+	gzipAssets        GzipAssets
+	compress          bool
+	preserveModTime   bool
+	generateSeoFiles  bool
+	mountPath         string
+	underConstruction bool
+	deployLock        bool
+	deployLockTimeout time.Duration
+	deployLockOwner   string
+	forceDestroy      bool
+	cdn               string
+	externalRedirect  string
+	contentLanguages  map[string]string
+	storageClasses    map[string]string
+	cacheControl      map[string]string
+	bucketName        string
+	bucketNameSuffix  string
+	objectLock        ObjectLock
+
+	intelligentTiering IntelligentTiering
+	bucketMetrics      BucketMetrics
+
+	cacheQueryStrings         string
+	cacheQueryStringWhitelist []string
+	cors                      Cors
+	noCachePaths              []string
+	immutableAssets           ImmutableAssets
+	privateContent            PrivateContent
+	apiOrigin                 ApiOrigin
+	previewOrigin             PreviewOrigin
+	origins                   map[string]RouteOrigin
+	originCustomHeaders       map[string]map[string]string
+	routes                    []Route
+	canonicalize              Canonicalize
+	basicAuth                 BasicAuth
+	requestId                 RequestId
+
+	cachePolicyId           string
+	originRequestPolicyId   string
+	responseHeadersPolicyId string
+	cacheAcceptLanguage     bool
+	contentSecurityPolicy   ContentSecurityPolicy
+	customResponseHeaders   map[string]string
+	canonicalLinkHeader     bool
+
+	realtimeLogs RealtimeLogs
+
+	defaultRootObject      string
+	defaultRootObjectByEnv map[string]string
+
+	priceClass           string
+	priceClassByEnv      map[string]string
+	geoRestriction       GeoRestriction
+	originShield         string
+	distributionEnabled  bool
+	enhancedMetrics      bool
+	errorAlarm           ErrorAlarm
+	prewarm              Prewarm
+	distributionWait     string
+	waitFailureMode      string
+	transferAcceleration bool
+	emitImportMap        bool
+	secretOutputs        []string
+	strictPolicyLint     bool
+	strictValidation     bool
+	createZoneIfMissing  bool
+	recordType           string
+	canonicalUrl         string
+	ipStack              string
+	ipv6Enabled          bool
+	evaluateTargetHealth bool
+	routingPolicy        RoutingPolicy
+
+	certificateArn     string
+	certificateDomains []string
+	reuseExistingCert  bool
+	iamCertificateId   string
+
+	certificateTransparency string
+
+	customErrorResponses  map[int]ErrorResponse
+	forbiddenResponseCode int
+	errorDocumentTtl      int
+	noBucketErrorDocument bool
+
+	fileTags      map[string]string
+	extraTags     map[string]string
+	requiredTags  []string
+	nameTagFormat string
+}
+
+// defaultUploadConcurrency is the number of website files processed at a
+// time when `uploadConcurrency` is not configured.
+const defaultUploadConcurrency = 10
+
+// defaultEtagPartSize is the part size in MiB of the multipart uploads of
+// the AWS CLI and SDKs, which `sourceHash: etag` assumes by default.
+const defaultEtagPartSize = 8
+
+// configSource is where the optional settings are read from. It is
+// satisfied by the stack configuration and by a site's overrides.
+type configSource interface {
+	Get(key string) string
+	GetObject(key string, output interface{}) error
+}
+
+// loadConfig reads the optional settings from cfg and validates them
+// against the stack, its AWS partition and the hostnames served by the
+// website.
+func loadConfig(cfg configSource, stack string, partition Partition, hostnames []string) (Config, error) {
+	c := Config{}
+	var err error
+
+	if err = cfg.GetObject("perHostRootObject", &c.perHostRootObject); err != nil {
+		return c, fmt.Errorf("perHostRootObject: %w", err)
+	}
+	for host, hro := range c.perHostRootObject {
+		if !contains(hostnames, host) {
+			return c, fmt.Errorf("perHostRootObject: %q is not one of %v", host, hostnames)
+		}
+		if hro.OriginPath != "" && (!strings.HasPrefix(hro.OriginPath, "/") || strings.HasSuffix(hro.OriginPath, "/")) {
+			return c, fmt.Errorf("perHostRootObject: origin path %q for %q must start with and not end with '/'", hro.OriginPath, host)
+		}
+	}
+
+	// The `Name` tag of the main resources follows `nameTagFormat`, with
+	// `none` leaving it unset.
+	c.nameTagFormat = cfg.Get("nameTagFormat")
+	if c.nameTagFormat == "" {
+		c.nameTagFormat = "{project}-{environment}-{host}-{resource}"
+	}
+	for _, m := range nameTagFieldRe.FindAllStringSubmatch(c.nameTagFormat, -1) {
+		if !contains(nameTagFields, m[1]) {
+			return c, fmt.Errorf("nameTagFormat: {%s} is not one of {%s}", m[1], strings.Join(nameTagFields, "}, {"))
+		}
+	}
+
+	// `tagsFile` is a shared JSON or YAML file of tags, such as the
+	// tagging standard of an organisation, that `extraTags` can override.
+	if tagsFile := cfg.Get("tagsFile"); tagsFile != "" {
+		if c.fileTags, err = readTagsFile(tagsFile); err != nil {
+			return c, fmt.Errorf("tagsFile: %w", err)
+		}
+		for key, value := range c.fileTags {
+			if !validTag(key, value) {
+				return c, fmt.Errorf("tagsFile: %q must be 1 to 128 characters, not start with 'aws:' and have a value of at most 256 characters", key)
+			}
+		}
+	}
+	if err = cfg.GetObject("extraTags", &c.extraTags); err != nil {
+		return c, fmt.Errorf("extraTags: %w", err)
+	}
+	for key, value := range c.extraTags {
+		if !validTag(key, value) {
+			return c, fmt.Errorf("extraTags: %q must be 1 to 128 characters, not start with 'aws:' and have a value of at most 256 characters", key)
+		}
+	}
+	if err = cfg.GetObject("requiredTags", &c.requiredTags); err != nil {
+		return c, fmt.Errorf("requiredTags: %w", err)
+	}
+
+	c.uploadConcurrency, err = getInt(cfg, "uploadConcurrency", defaultUploadConcurrency)
+	if err != nil {
+		return c, err
+	}
+	if c.uploadConcurrency < 1 {
+		return c, fmt.Errorf("uploadConcurrency: must be at least 1, got %d", c.uploadConcurrency)
+	}
+	c.uploadProgress, err = getInt(cfg, "uploadProgress", 0)
+	if err != nil {
+		return c, err
+	}
+	if c.uploadProgress < 0 {
+		return c, fmt.Errorf("uploadProgress: must not be negative, got %d", c.uploadProgress)
+	}
+
+	// A build that produced far fewer files than usual is most likely
+	// broken, and deploying it would delete the rest of the site.
+	c.minFileCount, err = getInt(cfg, "minFileCount", 0)
+	if err != nil {
+		return c, err
+	}
+	if c.minFileCount < 0 {
+		return c, fmt.Errorf("minFileCount: must not be negative, got %d", c.minFileCount)
+	}
+
+	// Objects are uploaded again when their source hash changes. The etag
+	// hash is the ETag S3 gives an object uploaded in parts of
+	// `etagPartSize` MiB, so it can be compared with the bucket.
+	c.sourceHash = cfg.Get("sourceHash")
+	if c.sourceHash == "" {
+		c.sourceHash = "sha256"
+	}
+	if c.sourceHash != "sha256" && c.sourceHash != "etag" {
+		return c, fmt.Errorf("sourceHash: must be sha256 or etag, got %q", c.sourceHash)
+	}
+	c.etagPartSize, err = getInt(cfg, "etagPartSize", defaultEtagPartSize)
+	if err != nil {
+		return c, err
+	}
+	if c.etagPartSize < 5 || c.etagPartSize > 5120 {
+		return c, fmt.Errorf("etagPartSize: must be between 5 and 5120 MiB, got %d", c.etagPartSize)
+	}
+
+	c.excludePatterns = defaultExcludePatterns
+	if err = cfg.GetObject("excludePatterns", &c.excludePatterns); err != nil {
+		return c, fmt.Errorf("excludePatterns: %w", err)
+	}
+	for _, pattern := range c.excludePatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return c, fmt.Errorf("excludePatterns: %q is not a valid pattern", pattern)
+		}
+	}
+
+	if err = cfg.GetObject("cleanUrlKeys", &c.cleanUrlKeys); err != nil {
+		return c, fmt.Errorf("cleanUrlKeys: %w", err)
+	}
+	switch c.cleanUrlKeys.Original {
+	case "":
+		c.cleanUrlKeys.Original = "omit"
+	case "omit", "redirect":
+	default:
+		return c, fmt.Errorf("cleanUrlKeys: original must be omit or redirect, got %q", c.cleanUrlKeys.Original)
+	}
+
+	// With `directoryKeys` every directory index is also uploaded under
+	// the key of its directory, which is what a request for the directory
+	// URL asks the bucket for.
+	c.directoryKeys, err = getBool(cfg, "directoryKeys", false)
+	if err != nil {
+		return c, err
+	}
+
+	c.compress, err = getBool(cfg, "compress", false)
+	if err != nil {
+		return c, err
+	}
+
+	c.preserveModTime, err = getBool(cfg, "preserveModTime", false)
+	if err != nil {
+		return c, err
+	}
+
+	c.generateSeoFiles, err = getBool(cfg, "generateSeoFiles", false)
+	if err != nil {
+		return c, err
+	}
+
+	// With `mountPath` the website is served below a path of the domain,
+	// such as `/docs`, with its objects uploaded below the same prefix.
+	c.mountPath = cfg.Get("mountPath")
+	if c.mountPath != "" {
+		if !mountPathRe.MatchString(c.mountPath) || !fs.ValidPath(strings.TrimPrefix(c.mountPath, "/")) {
+			return c, fmt.Errorf("mountPath: %q must start with and not end with '/', such as /docs", c.mountPath)
+		}
+		if len(c.perHostRootObject) > 0 {
+			return c, fmt.Errorf("mountPath: can not be combined with perHostRootObject")
+		}
+		if c.generateSeoFiles {
+			return c, fmt.Errorf("mountPath: can not be combined with generateSeoFiles, as robots.txt must be at the root of the domain")
+		}
+	}
+
+	c.stripPrefix = strings.Trim(cfg.Get("stripPrefix"), "/")
+	if c.stripPrefix != "" && (!fs.ValidPath(c.stripPrefix) || c.stripPrefix == ".") {
+		return c, fmt.Errorf("stripPrefix: %q must be a directory path relative to the site directory", c.stripPrefix)
+	}
+
+	if err = cfg.GetObject("gzipAssets", &c.gzipAssets); err != nil {
+		return c, fmt.Errorf("gzipAssets: %w", err)
+	}
+	if c.gzipAssets.Enabled {
+		if c.gzipAssets.MinSize == 0 {
+			c.gzipAssets.MinSize = 1024
+		}
+		if c.gzipAssets.MinSize < 0 {
+			return c, fmt.Errorf("gzipAssets: minSize must not be negative")
+		}
+		if len(c.gzipAssets.Extensions) == 0 {
+			c.gzipAssets.Extensions = defaultGzipExtensions
+		}
+		for _, ext := range c.gzipAssets.Extensions {
+			if !strings.HasPrefix(ext, ".") {
+				return c, fmt.Errorf("gzipAssets: extension %q must start with '.'", ext)
+			}
+			if contains(compressedExtensions, strings.ToLower(ext)) {
+				return c, fmt.Errorf("gzipAssets: %q files are already compressed", ext)
+			}
+		}
+	}
+
+	if err = cfg.GetObject("storageClasses", &c.storageClasses); err != nil {
+		return c, fmt.Errorf("storageClasses: %w", err)
+	}
+	for pattern, class := range c.storageClasses {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return c, fmt.Errorf("storageClasses: %q is not a valid pattern", pattern)
+		}
+		if class == "GLACIER" || class == "DEEP_ARCHIVE" {
+			return c, fmt.Errorf("storageClasses: %s objects for %q must be restored before they can be served", class, pattern)
+		}
+		if !contains(storageClasses, class) {
+			return c, fmt.Errorf("storageClasses: %q for %q must be one of %v", class, pattern, storageClasses)
+		}
+	}
+
+	// `cacheControl` sets the Cache-Control header objects are uploaded
+	// with by file extension, such as `stale-while-revalidate` for HTML.
+	if err = cfg.GetObject("cacheControl", &c.cacheControl); err != nil {
+		return c, fmt.Errorf("cacheControl: %w", err)
+	}
+	for ext, value := range c.cacheControl {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return c, fmt.Errorf("cacheControl: extension %q must start with '.'", ext)
+		}
+		if err := validateCacheControl(value); err != nil {
+			return c, fmt.Errorf("cacheControl: %s: %w", ext, err)
+		}
+	}
+
+	// The archive tiers only apply to objects stored in the
+	// INTELLIGENT_TIERING class, so one of the storageClasses must be.
+	if err = cfg.GetObject("intelligentTiering", &c.intelligentTiering); err != nil {
+		return c, fmt.Errorf("intelligentTiering: %w", err)
+	}
+	if it := c.intelligentTiering; it.Enabled {
+		tiered := false
+		for _, class := range c.storageClasses {
+			tiered = tiered || class == "INTELLIGENT_TIERING"
+		}
+		if !tiered {
+			return c, fmt.Errorf("intelligentTiering: requires storageClasses to store some objects as INTELLIGENT_TIERING")
+		}
+		if it.ArchiveAccessDays == 0 && it.DeepArchiveAccessDays == 0 {
+			return c, fmt.Errorf("intelligentTiering: requires archiveAccessDays, deepArchiveAccessDays or both")
+		}
+		if it.ArchiveAccessDays != 0 && (it.ArchiveAccessDays < 90 || it.ArchiveAccessDays > 730) {
+			return c, fmt.Errorf("intelligentTiering: archiveAccessDays must be between 90 and 730, got %d", it.ArchiveAccessDays)
+		}
+		if it.DeepArchiveAccessDays != 0 && (it.DeepArchiveAccessDays < 180 || it.DeepArchiveAccessDays > 730) {
+			return c, fmt.Errorf("intelligentTiering: deepArchiveAccessDays must be between 180 and 730, got %d", it.DeepArchiveAccessDays)
+		}
+		if it.ArchiveAccessDays != 0 && it.DeepArchiveAccessDays != 0 && it.DeepArchiveAccessDays <= it.ArchiveAccessDays {
+			return c, fmt.Errorf("intelligentTiering: deepArchiveAccessDays must be more than archiveAccessDays")
+		}
+		if strings.HasPrefix(it.Prefix, "/") {
+			return c, fmt.Errorf("intelligentTiering: prefix %q is an object key prefix and must not start with '/'", it.Prefix)
+		}
+	}
+
+	// Request metrics are billed per metric, so they are opt-in.
+	if err = cfg.GetObject("bucketMetrics", &c.bucketMetrics); err != nil {
+		return c, fmt.Errorf("bucketMetrics: %w", err)
+	}
+	if strings.HasPrefix(c.bucketMetrics.Prefix, "/") {
+		return c, fmt.Errorf("bucketMetrics: prefix %q is an object key prefix and must not start with '/'", c.bucketMetrics.Prefix)
+	}
+
+	// The bucket is private behind CloudFront so its name does not need
+	// to match any of the hostnames.
+	naming := cfg.Get("bucketNaming")
+	if naming == "" && cfg.Get("bucketName") != "" {
+		naming = "custom"
+	}
+	switch naming {
+	case "", "www-domain":
+		c.bucketName = fmt.Sprintf("www.%s", hostnames[0])
+	case "domain-only":
+		c.bucketName = hostnames[0]
+	case "custom":
+		c.bucketName = cfg.Get("bucketName")
+		if c.bucketName == "" {
+			return c, fmt.Errorf("bucketNaming: 'custom' requires bucketName to be set")
+		}
+	default:
+		return c, fmt.Errorf("bucketNaming: must be one of www-domain, domain-only or custom, got %q", naming)
+	}
+	// A suffix keeps the bucket name globally unique when several stacks
+	// or teams deploy the same domain. The random suffix is generated by
+	// S3 from a bucket name prefix and kept in the stack state.
+	c.bucketNameSuffix = cfg.Get("bucketNameSuffix")
+	switch c.bucketNameSuffix {
+	case "", "none":
+		c.bucketNameSuffix = "none"
+	case "stack":
+		c.bucketName = fmt.Sprintf("%s-%s", c.bucketName, strings.ToLower(stackNameRe.ReplaceAllString(stack, "-")))
+	case "random":
+		if len(c.bucketName) > 36 {
+			return c, fmt.Errorf("bucketNameSuffix: bucket name %q must be at most 36 characters to leave room for the random suffix", c.bucketName)
+		}
+	default:
+		return c, fmt.Errorf("bucketNameSuffix: must be one of none, stack or random, got %q", c.bucketNameSuffix)
+	}
+	if err = validateBucketName(c.bucketName); err != nil {
+		return c, err
+	}
+
+	// S3 only deletes an empty bucket, so objects the stack does not
+	// manage make `pulumi destroy` fail unless `forceDestroy` is set.
+	c.forceDestroy, err = getBool(cfg, "forceDestroy", false)
+	if err != nil {
+		return c, err
+	}
+
+	// The first deployment is told apart by the bucket not existing yet,
+	// which can not be looked up when S3 picks its name.
+	c.underConstruction, err = getBool(cfg, "underConstruction", false)
+	if err != nil {
+		return c, err
+	}
+	if c.underConstruction && c.bucketNameSuffix == "random" {
+		return c, fmt.Errorf("underConstruction: can not be combined with bucketNameSuffix random")
+	}
+
+	// The lock object of `deployLock` is looked up by the bucket name
+	// before the bucket is known, like the bucket of `underConstruction`.
+	c.deployLock, err = getBool(cfg, "deployLock", false)
+	if err != nil {
+		return c, err
+	}
+	c.deployLockTimeout = time.Hour
+	if timeout := cfg.Get("deployLockTimeout"); timeout != "" {
+		if c.deployLockTimeout, err = time.ParseDuration(timeout); err != nil || c.deployLockTimeout <= 0 {
+			return c, fmt.Errorf("deployLockTimeout: %q is not a positive duration such as 30m", timeout)
+		}
+	}
+	c.deployLockOwner = cfg.Get("deployLockOwner")
+	if c.deployLock && c.bucketNameSuffix == "random" {
+		return c, fmt.Errorf("deployLock: can not be combined with bucketNameSuffix random")
+	}
+
+	if err = cfg.GetObject("objectLock", &c.objectLock); err != nil {
+		return c, fmt.Errorf("objectLock: %w", err)
+	}
+	if c.objectLock.Enabled {
+		c.objectLock.Mode = strings.ToUpper(c.objectLock.Mode)
+		if c.objectLock.Mode == "" {
+			c.objectLock.Mode = "GOVERNANCE"
+		}
+		if c.objectLock.Mode != "GOVERNANCE" && c.objectLock.Mode != "COMPLIANCE" {
+			return c, fmt.Errorf("objectLock: mode must be governance or compliance, got %q", c.objectLock.Mode)
+		}
+		if c.objectLock.Days < 1 {
+			return c, fmt.Errorf("objectLock: days must be at least 1, got %d", c.objectLock.Days)
+		}
+	}
+
+	// A `cacheQueryStringWhitelist` on its own implies 'whitelist', so that
+	// cache-busting parameters such as `v` are kept while tracking ones
+	// such as `utm_source` are dropped from the cache key.
+	if err = cfg.GetObject("cacheQueryStringWhitelist", &c.cacheQueryStringWhitelist); err != nil {
+		return c, fmt.Errorf("cacheQueryStringWhitelist: %w", err)
+	}
+	c.cacheQueryStrings = cfg.Get("cacheQueryStrings")
+	if c.cacheQueryStrings == "" {
+		c.cacheQueryStrings = "none"
+		if len(c.cacheQueryStringWhitelist) > 0 {
+			c.cacheQueryStrings = "whitelist"
+		}
+	}
+	if len(c.cacheQueryStringWhitelist) > maxCacheQueryStrings {
+		return c, fmt.Errorf("cacheQueryStringWhitelist: CloudFront allows at most %d query strings in a cache policy, got %d", maxCacheQueryStrings, len(c.cacheQueryStringWhitelist))
+	}
+	for i, name := range c.cacheQueryStringWhitelist {
+		if !queryStringNameRe.MatchString(name) {
+			return c, fmt.Errorf("cacheQueryStringWhitelist: %q is not a valid query string parameter name", name)
+		}
+		if contains(c.cacheQueryStringWhitelist[:i], name) {
+			return c, fmt.Errorf("cacheQueryStringWhitelist: %q is listed more than once", name)
+		}
+	}
+	switch c.cacheQueryStrings {
+	case "none", "all":
+		if len(c.cacheQueryStringWhitelist) > 0 {
+			return c, fmt.Errorf("cacheQueryStringWhitelist: requires cacheQueryStrings to be 'whitelist'")
+		}
+	case "whitelist":
+		if len(c.cacheQueryStringWhitelist) == 0 {
+			return c, fmt.Errorf("cacheQueryStrings: 'whitelist' requires cacheQueryStringWhitelist to be set")
+		}
+	default:
+		return c, fmt.Errorf("cacheQueryStrings: must be one of none, all or whitelist, got %q", c.cacheQueryStrings)
+	}
+
+	if err = cfg.GetObject("cors", &c.cors); err != nil {
+		return c, fmt.Errorf("cors: %w", err)
+	}
+	if c.cors.Enabled {
+		if len(c.cors.AllowedOrigins) == 0 {
+			c.cors.AllowedOrigins = []string{"*"}
+		}
+		if c.cors.PreflightTtl == 0 {
+			c.cors.PreflightTtl = 86400
+		}
+		if c.cors.PreflightTtl < 0 {
+			return c, fmt.Errorf("cors: preflightTtl must not be negative")
+		}
+	}
+
+	// `contentLanguages` maps key prefixes, such as `fr/`, to the language
+	// of the objects below them.
+	if err = cfg.GetObject("contentLanguages", &c.contentLanguages); err != nil {
+		return c, fmt.Errorf("contentLanguages: %w", err)
+	}
+	for prefix, tag := range c.contentLanguages {
+		if strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+			return c, fmt.Errorf("contentLanguages: prefix %q must not start with and must end with '/'", prefix)
+		}
+		if !languageTagRe.MatchString(tag) {
+			return c, fmt.Errorf("contentLanguages: %q for %q is not a BCP 47 language tag such as fr or pt-BR", tag, prefix)
+		}
+	}
+	c.cacheAcceptLanguage, err = getBool(cfg, "cacheAcceptLanguage", false)
+	if err != nil {
+		return c, err
+	}
+
+	// AWS managed policies for the default cache behavior, by name.
+	if name := cfg.Get("cachePolicy"); name != "" {
+		if c.cacheQueryStrings != "none" || c.cors.Enabled || c.cacheAcceptLanguage {
+			return c, fmt.Errorf("cachePolicy: can not be combined with cacheQueryStrings, cors or cacheAcceptLanguage, which create a custom cache policy")
+		}
+		if c.cachePolicyId, err = managedPolicyId(managedCachePolicies, name); err != nil {
+			return c, fmt.Errorf("cachePolicy: %w", err)
+		}
+	}
+	if name := cfg.Get("originRequestPolicy"); name != "" {
+		// CloudFront only accepts an origin request policy together with a
+		// cache policy, not with the legacy forwarded values.
+		if c.cachePolicyId == "" && c.cacheQueryStrings == "none" && !c.cors.Enabled && !c.cacheAcceptLanguage {
+			return c, fmt.Errorf("originRequestPolicy: requires a cache policy, set cachePolicy, cacheQueryStrings, cors or cacheAcceptLanguage")
+		}
+		if c.originRequestPolicyId, err = managedPolicyId(managedOriginRequestPolicies, name); err != nil {
+			return c, fmt.Errorf("originRequestPolicy: %w", err)
+		}
+	}
+	if name := cfg.Get("responseHeadersPolicy"); name != "" {
+		if c.responseHeadersPolicyId, err = managedPolicyId(managedResponseHeadersPolicies, name); err != nil {
+			return c, fmt.Errorf("responseHeadersPolicy: %w", err)
+		}
+	}
+
+	// The policies are sent through a response headers policy of the
+	// stack, which takes the place of a managed one.
+	if err = cfg.GetObject("contentSecurityPolicy", &c.contentSecurityPolicy); err != nil {
+		return c, fmt.Errorf("contentSecurityPolicy: %w", err)
+	}
+	csp := c.contentSecurityPolicy
+	if csp.Enabled() && c.responseHeadersPolicyId != "" {
+		return c, fmt.Errorf("contentSecurityPolicy: can not be combined with responseHeadersPolicy")
+	}
+	if csp.ReportUri != "" && !csp.Enabled() {
+		return c, fmt.Errorf("contentSecurityPolicy: reportUri requires policy or reportOnly")
+	}
+	if csp.ReportUri != "" && (strings.ContainsAny(csp.ReportUri, " ;,") || !(strings.HasPrefix(csp.ReportUri, "https://") || strings.HasPrefix(csp.ReportUri, "/"))) {
+		return c, fmt.Errorf("contentSecurityPolicy: reportUri %q must be an https:// URL or a path", csp.ReportUri)
+	}
+	for _, policy := range []string{csp.Policy, csp.ReportOnly} {
+		if strings.ContainsAny(policy, "\r\n") {
+			return c, fmt.Errorf("contentSecurityPolicy: policies must be a single line")
+		}
+		if csp.ReportUri != "" && strings.Contains(policy, "report-uri") {
+			return c, fmt.Errorf("contentSecurityPolicy: %q already has a report-uri, remove it or reportUri", policy)
+		}
+	}
+
+	// With `canonicalLinkHeader` a CloudFront Function adds a Link header
+	// naming the canonical URL of each page to its responses.
+	c.canonicalLinkHeader, err = getBool(cfg, "canonicalLinkHeader", false)
+	if err != nil {
+		return c, err
+	}
+
+	// `customResponseHeaders` are sent with every response through the
+	// same response headers policy. The security headers have settings of
+	// their own in a response headers policy and can not be set as custom
+	// headers.
+	if err = cfg.GetObject("customResponseHeaders", &c.customResponseHeaders); err != nil {
+		return c, fmt.Errorf("customResponseHeaders: %w", err)
+	}
+	if len(c.customResponseHeaders) > 0 && c.responseHeadersPolicyId != "" {
+		return c, fmt.Errorf("customResponseHeaders: can not be combined with responseHeadersPolicy")
+	}
+	for name, value := range c.customResponseHeaders {
+		lower := strings.ToLower(name)
+		switch {
+		case !headerNameRe.MatchString(name):
+			return c, fmt.Errorf("customResponseHeaders: %q is not a valid header name", name)
+		case contains(reservedResponseHeaders, lower) || contains(reservedOriginHeaders, lower):
+			return c, fmt.Errorf("customResponseHeaders: %s can not be set as a custom response header", name)
+		case lower == "content-security-policy-report-only" && csp.ReportOnly != "":
+			return c, fmt.Errorf("customResponseHeaders: %s is already set by contentSecurityPolicy.reportOnly", name)
+		case lower == "link" && c.canonicalLinkHeader:
+			return c, fmt.Errorf("customResponseHeaders: %s is already set by canonicalLinkHeader", name)
+		case value == "" || strings.ContainsAny(value, "\r\n"):
+			return c, fmt.Errorf("customResponseHeaders: the value of %s must be a single non-empty line", name)
+		}
+	}
+
+	if err = cfg.GetObject("noCachePaths", &c.noCachePaths); err != nil {
+		return c, fmt.Errorf("noCachePaths: %w", err)
+	}
+	if err = validatePathPatterns(c.noCachePaths); err != nil {
+		return c, fmt.Errorf("noCachePaths: %w", err)
+	}
+
+	if err = cfg.GetObject("immutableAssets", &c.immutableAssets); err != nil {
+		return c, fmt.Errorf("immutableAssets: %w", err)
+	}
+	if c.immutableAssets.Enabled {
+		if len(c.immutableAssets.PathPatterns) == 0 {
+			c.immutableAssets.PathPatterns = []string{"/assets/*"}
+		}
+		if c.immutableAssets.Ttl == 0 {
+			c.immutableAssets.Ttl = 31536000
+		}
+		if c.immutableAssets.Ttl < 0 {
+			return c, fmt.Errorf("immutableAssets: ttl must not be negative")
+		}
+		if err = validatePathPatterns(c.behaviorPatterns()); err != nil {
+			return c, fmt.Errorf("immutableAssets: %w", err)
+		}
+	}
+
+	if err = cfg.GetObject("privateContent", &c.privateContent); err != nil {
+		return c, fmt.Errorf("privateContent: %w", err)
+	}
+	if c.privateContent.Enabled {
+		if len(c.privateContent.PathPatterns) == 0 {
+			return c, fmt.Errorf("privateContent: requires at least one path pattern")
+		}
+		if len(c.privateContent.KeyGroupIds) == 0 && c.privateContent.PublicKey == "" {
+			return c, fmt.Errorf("privateContent: requires a publicKey or at least one key group ID")
+		}
+		if c.privateContent.PublicKey != "" {
+			if err = validatePublicKey(c.privateContent.PublicKey); err != nil {
+				return c, fmt.Errorf("privateContent: %w", err)
+			}
+		}
+		if err = validatePathPatterns(c.behaviorPatterns()); err != nil {
+			return c, fmt.Errorf("privateContent: %w", err)
+		}
+	}
+
+	if err = cfg.GetObject("apiOrigin", &c.apiOrigin); err != nil {
+		return c, fmt.Errorf("apiOrigin: %w", err)
+	}
+	if c.apiOrigin.DomainName != "" {
+		if err = validateDomain(c.apiOrigin.DomainName); err != nil {
+			return c, fmt.Errorf("apiOrigin: %w", err)
+		}
+		if c.apiOrigin.PathPattern == "" {
+			c.apiOrigin.PathPattern = "/api/*"
+		}
+		if err = validatePathPatterns(c.behaviorPatterns()); err != nil {
+			return c, fmt.Errorf("apiOrigin: %w", err)
+		}
+		if c.apiOrigin.OriginProtocolPolicy, err = validateOriginProtocolPolicy("apiOrigin", c.apiOrigin.OriginProtocolPolicy); err != nil {
+			return c, err
+		}
+		if c.apiOrigin.ReadTimeout == 0 {
+			c.apiOrigin.ReadTimeout = 30
+		}
+		if c.apiOrigin.ReadTimeout < 1 || c.apiOrigin.ReadTimeout > 180 {
+			return c, fmt.Errorf("apiOrigin: readTimeout must be between 1 and 180 seconds, got %d", c.apiOrigin.ReadTimeout)
+		}
+		if c.apiOrigin.KeepaliveTimeout == 0 {
+			c.apiOrigin.KeepaliveTimeout = 5
+		}
+		if c.apiOrigin.KeepaliveTimeout < 1 || c.apiOrigin.KeepaliveTimeout > 180 {
+			return c, fmt.Errorf("apiOrigin: keepaliveTimeout must be between 1 and 180 seconds, got %d", c.apiOrigin.KeepaliveTimeout)
+		}
+	} else if c.apiOrigin != (ApiOrigin{}) {
+		return c, fmt.Errorf("apiOrigin: requires domainName to be set")
+	}
+
+	if err = cfg.GetObject("previewOrigin", &c.previewOrigin); err != nil {
+		return c, fmt.Errorf("previewOrigin: %w", err)
+	}
+	if c.previewOrigin.DomainName != "" {
+		if err = validateDomain(c.previewOrigin.DomainName); err != nil {
+			return c, fmt.Errorf("previewOrigin: %w", err)
+		}
+		if c.previewOrigin.PathPattern == "" {
+			c.previewOrigin.PathPattern = "/preview/*"
+		}
+		if err = validatePathPatterns(c.behaviorPatterns()); err != nil {
+			return c, fmt.Errorf("previewOrigin: %w", err)
+		}
+		if c.previewOrigin.OriginProtocolPolicy, err = validateOriginProtocolPolicy("previewOrigin", c.previewOrigin.OriginProtocolPolicy); err != nil {
+			return c, err
+		}
+	} else if c.previewOrigin != (PreviewOrigin{}) {
+		return c, fmt.Errorf("previewOrigin: requires domainName to be set")
+	}
+
+	if err = cfg.GetObject("origins", &c.origins); err != nil {
+		return c, fmt.Errorf("origins: %w", err)
+	}
+	for name, origin := range c.origins {
+		if !siteNameRe.MatchString(name) {
+			return c, fmt.Errorf("origins: %q may only contain lowercase letters, numbers and hyphens", name)
+		}
+		if origin.OriginPath != "" && (!strings.HasPrefix(origin.OriginPath, "/") || strings.HasSuffix(origin.OriginPath, "/")) {
+			return c, fmt.Errorf("origins: originPath %q of %s must start with and not end with '/'", origin.OriginPath, name)
+		}
+		switch origin.Type {
+		case "bucket":
+			if origin.BucketName != "" {
+				if err = validateBucketName(origin.BucketName); err != nil {
+					return c, fmt.Errorf("origins: %s: %w", name, err)
+				}
+			}
+		case "custom":
+			if err = validateDomain(origin.DomainName); err != nil {
+				return c, fmt.Errorf("origins: %s: %w", name, err)
+			}
+			if origin.OriginProtocolPolicy, err = validateOriginProtocolPolicy("origins: "+name, origin.OriginProtocolPolicy); err != nil {
+				return c, err
+			}
+		default:
+			return c, fmt.Errorf("origins: type of %s must be bucket or custom, got %q", name, origin.Type)
+		}
+		c.origins[name] = origin
+	}
+
+	// `originCustomHeaders` adds headers, such as a shared secret the
+	// origin checks to only accept requests from CloudFront, to the
+	// requests sent to `api`, `preview` or one of the `origins`.
+	if err = cfg.GetObject("originCustomHeaders", &c.originCustomHeaders); err != nil {
+		return c, fmt.Errorf("originCustomHeaders: %w", err)
+	}
+	for name, headers := range c.originCustomHeaders {
+		_, isOrigin := c.origins[name]
+		builtin := (name == "api" && c.apiOrigin.DomainName != "") || (name == "preview" && c.previewOrigin.DomainName != "")
+		switch {
+		case isOrigin && builtin:
+			return c, fmt.Errorf("originCustomHeaders: %q is both the %sOrigin and one of the origins, rename the origin", name, name)
+		case !isOrigin && !builtin:
+			return c, fmt.Errorf("originCustomHeaders: %q is not api, preview or one of the origins", name)
+		}
+		for header := range headers {
+			if err = validateCustomHeader(header); err != nil {
+				return c, fmt.Errorf("originCustomHeaders: %s: %w", name, err)
+			}
+		}
+	}
+
+	var routes []Route
+	if err = cfg.GetObject("routes", &routes); err != nil {
+		return c, fmt.Errorf("routes: %w", err)
+	}
+	for _, route := range routes {
+		origin, ok := c.origins[route.Origin]
+		if !ok {
+			return c, fmt.Errorf("routes: origin %q of %s is not defined in origins", route.Origin, route.PathPattern)
+		}
+		// Bucket content is cached and read only by default, custom
+		// origins are usually APIs that are neither.
+		if route.CachePolicy == "" {
+			route.CachePolicy = "CachingOptimized"
+			if origin.Type == "custom" {
+				route.CachePolicy = "CachingDisabled"
+			}
+		}
+		if route.cachePolicyId, err = managedPolicyId(managedCachePolicies, route.CachePolicy); err != nil {
+			return c, fmt.Errorf("routes: cachePolicy of %s: %w", route.PathPattern, err)
+		}
+		if route.OriginRequestPolicy == "" && origin.Type == "custom" {
+			route.OriginRequestPolicy = "AllViewerExceptHostHeader"
+		}
+		if route.OriginRequestPolicy != "" {
+			if route.originRequestPolicyId, err = managedPolicyId(managedOriginRequestPolicies, route.OriginRequestPolicy); err != nil {
+				return c, fmt.Errorf("routes: originRequestPolicy of %s: %w", route.PathPattern, err)
+			}
+		}
+		switch route.Methods {
+		case "":
+			route.Methods = "read"
+			if origin.Type == "custom" {
+				route.Methods = "all"
+			}
+		case "read", "all":
+		default:
+			return c, fmt.Errorf("routes: methods of %s must be read or all, got %q", route.PathPattern, route.Methods)
+		}
+		c.routes = append(c.routes, route)
+	}
+	if err = validatePathPatterns(c.behaviorPatterns()); err != nil {
+		return c, fmt.Errorf("routes: %w", err)
+	}
+
+	if err = cfg.GetObject("canonicalize", &c.canonicalize); err != nil {
+		return c, fmt.Errorf("canonicalize: %w", err)
+	}
+	switch c.canonicalize.TrailingSlash {
+	case "", "add":
+	case "remove":
+		if c.canonicalize.StripIndex {
+			return c, fmt.Errorf("canonicalize: stripIndex redirects to a trailing slash and can not be combined with removing it")
+		}
+	default:
+		return c, fmt.Errorf("canonicalize: trailingSlash must be add or remove, got %q", c.canonicalize.TrailingSlash)
+	}
+
+	if err = cfg.GetObject("basicAuth", &c.basicAuth); err != nil {
+		return c, fmt.Errorf("basicAuth: %w", err)
+	}
+	if c.basicAuth != (BasicAuth{}) {
+		if c.basicAuth.Username == "" || strings.Contains(c.basicAuth.Username, ":") {
+			return c, fmt.Errorf("basicAuth: username must be set and must not contain ':'")
+		}
+		if c.basicAuth.Password == "" {
+			return c, fmt.Errorf("basicAuth: password must be set")
+		}
+		// CloudFront runs a single function per event type on a behavior.
+		if c.canonicalize.Enabled() {
+			return c, fmt.Errorf("basicAuth: can not be combined with canonicalize, both run on viewer requests")
+		}
+	}
+
+	// The request-id CloudFront Function runs on both the viewer request
+	// and the viewer response, so it takes the place of any other function.
+	if err = cfg.GetObject("requestId", &c.requestId); err != nil {
+		return c, fmt.Errorf("requestId: %w", err)
+	}
+	if c.requestId.Enabled {
+		if c.requestId.Header == "" {
+			c.requestId.Header = "x-request-id"
+		}
+		c.requestId.Header = strings.ToLower(c.requestId.Header)
+		if !headerNameRe.MatchString(c.requestId.Header) || strings.HasPrefix(c.requestId.Header, "x-amz-") || strings.HasPrefix(c.requestId.Header, "x-edge-") {
+			return c, fmt.Errorf("requestId: %q is not a header name CloudFront Functions can set", c.requestId.Header)
+		}
+		if contains(reservedOriginHeaders, c.requestId.Header) || contains(reservedResponseHeaders, c.requestId.Header) {
+			return c, fmt.Errorf("requestId: %s can not be used as the request ID header", c.requestId.Header)
+		}
+		if c.canonicalize.Enabled() || c.basicAuth != (BasicAuth{}) {
+			return c, fmt.Errorf("requestId: can not be combined with canonicalize or basicAuth, both run on viewer requests")
+		}
+		if c.canonicalLinkHeader {
+			return c, fmt.Errorf("requestId: can not be combined with canonicalLinkHeader, both run on viewer responses")
+		}
+		if _, ok := c.customResponseHeaders[c.requestId.Header]; ok {
+			return c, fmt.Errorf("customResponseHeaders: %s is already set by requestId", c.requestId.Header)
+		}
+	}
+
+	if err = cfg.GetObject("realtimeLogs", &c.realtimeLogs); err != nil {
+		return c, fmt.Errorf("realtimeLogs: %w", err)
+	}
+	if c.realtimeLogs.Enabled {
+		if c.realtimeLogs.SamplingRate == 0 {
+			c.realtimeLogs.SamplingRate = 100
+		}
+		if c.realtimeLogs.SamplingRate < 1 || c.realtimeLogs.SamplingRate > 100 {
+			return c, fmt.Errorf("realtimeLogs: samplingRate must be between 1 and 100, got %d", c.realtimeLogs.SamplingRate)
+		}
+		if len(c.realtimeLogs.Fields) == 0 {
+			c.realtimeLogs.Fields = defaultRealtimeLogFields
+		}
+		if c.realtimeLogs.StreamArn != "" && !strings.HasPrefix(c.realtimeLogs.StreamArn, "arn:") {
+			return c, fmt.Errorf("realtimeLogs: streamArn %q is not an ARN", c.realtimeLogs.StreamArn)
+		}
+	}
+
+	// Origin Shield adds a caching layer in one region between the edges
+	// and the bucket, best placed in the region of the bucket.
+	c.originShield = cfg.Get("originShield")
+	if c.originShield != "" && !contains(originShieldRegions, c.originShield) {
+		return c, fmt.Errorf("originShield: %q is not an Origin Shield region, must be one of %s", c.originShield, strings.Join(originShieldRegions, ", "))
+	}
+
+	c.priceClass = cfg.Get("priceClass")
+	if c.priceClass != "" && !contains(priceClasses, c.priceClass) {
+		return c, fmt.Errorf("priceClass: must be one of %v, got %q", priceClasses, c.priceClass)
+	}
+	if err = cfg.GetObject("priceClassByEnv", &c.priceClassByEnv); err != nil {
+		return c, fmt.Errorf("priceClassByEnv: %w", err)
+	}
+	for env, pc := range c.priceClassByEnv {
+		if !contains(priceClasses, pc) {
+			return c, fmt.Errorf("priceClassByEnv: %q for %q must be one of %v", pc, env, priceClasses)
+		}
+	}
+
+	c.defaultRootObject = cfg.Get("defaultRootObject")
+	if err = validateRootObject(c.defaultRootObject); err != nil {
+		return c, fmt.Errorf("defaultRootObject: %w", err)
+	}
+	if err = cfg.GetObject("defaultRootObjectByEnv", &c.defaultRootObjectByEnv); err != nil {
+		return c, fmt.Errorf("defaultRootObjectByEnv: %w", err)
+	}
+	for env, root := range c.defaultRootObjectByEnv {
+		if root == "" {
+			return c, fmt.Errorf("defaultRootObjectByEnv: root object for %q must not be empty", env)
+		}
+		if err = validateRootObject(root); err != nil {
+			return c, fmt.Errorf("defaultRootObjectByEnv: %q: %w", env, err)
+		}
+	}
+
+	if err = cfg.GetObject("geoRestriction", &c.geoRestriction); err != nil {
+		return c, fmt.Errorf("geoRestriction: %w", err)
+	}
+	switch c.geoRestriction.Type {
+	case "":
+		c.geoRestriction.Type = "none"
+		fallthrough
+	case "none":
+		if len(c.geoRestriction.Locations) > 0 {
+			return c, fmt.Errorf("geoRestriction: locations require a type of whitelist or blacklist")
+		}
+	case "whitelist", "blacklist":
+		if len(c.geoRestriction.Locations) == 0 {
+			return c, fmt.Errorf("geoRestriction: %s requires at least one location", c.geoRestriction.Type)
+		}
+		for _, location := range c.geoRestriction.Locations {
+			if !countryCodeRe.MatchString(location) {
+				return c, fmt.Errorf("geoRestriction: %q is not an ISO 3166-1 alpha-2 country code", location)
+			}
+		}
+	default:
+		return c, fmt.Errorf("geoRestriction: type must be one of none, whitelist or blacklist, got %q", c.geoRestriction.Type)
+	}
+
+	c.distributionEnabled, err = getBool(cfg, "distributionEnabled", true)
+	if err != nil {
+		return c, err
+	}
+
+	c.enhancedMetrics, err = getBool(cfg, "enhancedMetrics", false)
+	if err != nil {
+		return c, err
+	}
+
+	if err = cfg.GetObject("errorAlarm", &c.errorAlarm); err != nil {
+		return c, fmt.Errorf("errorAlarm: %w", err)
+	}
+	if c.errorAlarm.Enabled {
+		if c.errorAlarm.Threshold == 0 {
+			c.errorAlarm.Threshold = 5
+		}
+		if c.errorAlarm.Threshold < 0 || c.errorAlarm.Threshold > 100 {
+			return c, fmt.Errorf("errorAlarm: threshold must be a percentage between 0 and 100, got %v", c.errorAlarm.Threshold)
+		}
+		if c.errorAlarm.EvaluationPeriods == 0 {
+			c.errorAlarm.EvaluationPeriods = 5
+		}
+		if c.errorAlarm.EvaluationPeriods < 1 {
+			return c, fmt.Errorf("errorAlarm: evaluationPeriods must be at least 1, got %d", c.errorAlarm.EvaluationPeriods)
+		}
+		if c.errorAlarm.SnsTopicArn != "" && !strings.HasPrefix(c.errorAlarm.SnsTopicArn, fmt.Sprintf("arn:%s:sns:", partition.name)) {
+			return c, fmt.Errorf("errorAlarm: %q is not an SNS topic ARN", c.errorAlarm.SnsTopicArn)
+		}
+	}
+
+	if err = cfg.GetObject("prewarm", &c.prewarm); err != nil {
+		return c, fmt.Errorf("prewarm: %w", err)
+	}
+	if c.prewarm.Limit == 0 {
+		c.prewarm.Limit = 10
+	}
+	if c.prewarm.Limit < 1 || c.prewarm.Limit > 50 {
+		return c, fmt.Errorf("prewarm: limit must be between 1 and 50, got %d", c.prewarm.Limit)
+	}
+	if len(c.prewarm.Paths) > c.prewarm.Limit {
+		return c, fmt.Errorf("prewarm: %d paths are more than the limit of %d", len(c.prewarm.Paths), c.prewarm.Limit)
+	}
+	for _, p := range c.prewarm.Paths {
+		if !strings.HasPrefix(p, "/") {
+			return c, fmt.Errorf("prewarm: path %q must start with '/'", p)
+		}
+	}
+
+	// Outputs listed in `secretOutputs` are exported as secrets, encrypted
+	// in the state and hidden by `pulumi stack output` without
+	// `--show-secrets`.
+	if err = cfg.GetObject("secretOutputs", &c.secretOutputs); err != nil {
+		return c, fmt.Errorf("secretOutputs: %w", err)
+	}
+
+	// Pulumi waits for the distributions to be deployed to every edge,
+	// which can take a while, bounded by `distributionWaitTimeout`.
+	c.distributionWait = cfg.Get("distributionWaitTimeout")
+	if c.distributionWait != "" {
+		if d, err := time.ParseDuration(c.distributionWait); err != nil || d <= 0 {
+			return c, fmt.Errorf("distributionWaitTimeout: %q is not a positive duration such as 20m", c.distributionWait)
+		}
+	}
+	c.waitFailureMode = cfg.Get("waitFailureMode")
+	switch c.waitFailureMode {
+	case "":
+		c.waitFailureMode = "fail"
+	case "fail", "warn":
+	default:
+		return c, fmt.Errorf("waitFailureMode: must be fail or warn, got %q", c.waitFailureMode)
+	}
+
+	c.transferAcceleration, err = getBool(cfg, "transferAcceleration", false)
+	if err != nil {
+		return c, err
+	}
+	// S3 does not support Transfer Acceleration on bucket names with dots.
+	if c.transferAcceleration && strings.Contains(c.bucketName, ".") {
+		return c, fmt.Errorf("transferAcceleration: bucket name %q must not contain dots, use bucketNaming to choose another name", c.bucketName)
+	}
+
+	c.emitImportMap, err = getBool(cfg, "emitImportMap", false)
+	if err != nil {
+		return c, err
+	}
+
+	c.createZoneIfMissing, err = getBool(cfg, "createZoneIfMissing", false)
+	if err != nil {
+		return c, err
+	}
+
+	// Only the www record can be a CNAME, the apex of a zone can not hold
+	// one and always uses alias records.
+	switch rt := cfg.Get("recordType"); strings.ToLower(rt) {
+	case "", "alias":
+		c.recordType = "alias"
+	case "cname":
+		if len(hostnames) == 0 || !contains(hostnames, "www."+hostnames[0]) {
+			return c, fmt.Errorf("recordType: cname only applies to the www record, which requires wwwAlias")
+		}
+		c.recordType = "cname"
+	default:
+		return c, fmt.Errorf("recordType: must be alias or cname, got %q", rt)
+	}
+
+	// With `cdn: none` the hostnames are served by the bucket website
+	// endpoint, over HTTP only.
+	c.cdn = cfg.Get("cdn")
+	switch c.cdn {
+	case "":
+		c.cdn = "cloudfront"
+	case "cloudfront", "none":
+	default:
+		return c, fmt.Errorf("cdn: must be cloudfront or none, got %q", c.cdn)
+	}
+	scheme := "https"
+	if c.cdn == "none" {
+		scheme = "http"
+	}
+
+	// The canonical URL defaults to the apex domain. When set it must be
+	// served by the website.
+	c.canonicalUrl = scheme + "://" + hostnames[0]
+	if cu := cfg.Get("canonicalUrl"); cu != "" {
+		u, err := url.Parse(cu)
+		if err != nil || u.Scheme != scheme || !contains(hostnames, u.Host) || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			return c, fmt.Errorf("canonicalUrl: %q must be %s:// followed by one of %v", cu, scheme, hostnames)
+		}
+		c.canonicalUrl = scheme + "://" + u.Host
+	}
+
+	c.evaluateTargetHealth, err = getBool(cfg, "evaluateTargetHealth", false)
+	if err != nil {
+		return c, err
+	}
+
+	if err = cfg.GetObject("routingPolicy", &c.routingPolicy); err != nil {
+		return c, fmt.Errorf("routingPolicy: %w", err)
+	}
+	if err = validateRoutingPolicy(&c.routingPolicy); err != nil {
+		return c, fmt.Errorf("routingPolicy: %w", err)
+	}
+
+	c.ipv6Enabled, err = getBool(cfg, "ipv6Enabled", true)
+	if err != nil {
+		return c, err
+	}
+	c.ipStack = cfg.Get("ipStack")
+	if c.ipStack == "" {
+		c.ipStack = "dual"
+	}
+	switch c.ipStack {
+	case "dual", "v6only":
+		// An AAAA alias to a distribution without IPv6 does not resolve.
+		if !c.ipv6Enabled {
+			return c, fmt.Errorf("ipStack: %s creates AAAA records, which require ipv6Enabled, use v4only", c.ipStack)
+		}
+	case "v4only":
+	default:
+		return c, fmt.Errorf("ipStack: must be one of dual, v4only or v6only, got %q", c.ipStack)
+	}
+
+	c.certificateArn = cfg.Get("certificateArn")
+	if err = cfg.GetObject("certificateDomains", &c.certificateDomains); err != nil {
+		return c, fmt.Errorf("certificateDomains: %w", err)
+	}
+	// Legacy setups serve a server certificate uploaded to IAM instead of
+	// one from ACM.
+	c.iamCertificateId = cfg.Get("iamCertificateId")
+	if c.iamCertificateId != "" {
+		if !iamCertificateIdRe.MatchString(c.iamCertificateId) {
+			return c, fmt.Errorf("iamCertificateId: %q is not the ID of an IAM server certificate, such as ASCAEXAMPLE123456789", c.iamCertificateId)
+		}
+		if c.certificateArn != "" {
+			return c, fmt.Errorf("iamCertificateId: can not be combined with certificateArn")
+		}
+	}
+	if c.certificateArn != "" {
+		// CloudFront only accepts certificates from a single region.
+		if !strings.HasPrefix(c.certificateArn, fmt.Sprintf("arn:%s:acm:%s:", partition.name, partition.certificateRegion)) {
+			return c, fmt.Errorf("certificateArn: %w: %q is not an ACM certificate ARN in %s", ErrCertWrongRegion, c.certificateArn, partition.certificateRegion)
+		}
+	} else if len(c.certificateDomains) > 0 && c.iamCertificateId == "" {
+		return c, fmt.Errorf("certificateDomains: requires certificateArn or iamCertificateId to be set")
+	}
+
+	// An issued certificate covering the hostnames is looked up instead of
+	// issuing another, which `certificateArn` already names.
+	c.reuseExistingCert, err = getBool(cfg, "reuseExistingCert", false)
+	if err != nil {
+		return c, err
+	}
+	if c.reuseExistingCert && (c.certificateArn != "" || c.iamCertificateId != "") {
+		return c, fmt.Errorf("reuseExistingCert: can not be combined with certificateArn or iamCertificateId")
+	}
+
+	switch ct := cfg.Get("certificateTransparency"); strings.ToLower(ct) {
+	case "":
+	case "enabled", "disabled":
+		c.certificateTransparency = strings.ToUpper(ct)
+	default:
+		return c, fmt.Errorf("certificateTransparency: must be enabled or disabled, got %q", ct)
+	}
+	if c.certificateTransparency != "" && c.iamCertificateId != "" {
+		return c, fmt.Errorf("certificateTransparency: only applies to certificates issued by ACM, not iamCertificateId")
+	}
+
+	c.strictPolicyLint, err = getBool(cfg, "strictPolicyLint", false)
+	if err != nil {
+		return c, err
+	}
+
+	c.strictValidation, err = getBool(cfg, "strictValidation", false)
+	if err != nil {
+		return c, err
+	}
+
+	var errorResponses map[string]ErrorResponse
+	if err = cfg.GetObject("customErrorResponses", &errorResponses); err != nil {
+		return c, fmt.Errorf("customErrorResponses: %w", err)
+	}
+	c.customErrorResponses = map[int]ErrorResponse{}
+	for key, er := range errorResponses {
+		code, err := strconv.Atoi(key)
+		if err != nil || !containsInt(errorCodes, code) {
+			return c, fmt.Errorf("customErrorResponses: %q is not one of the supported error codes %v", key, errorCodes)
+		}
+		if er.Page != "" && !strings.HasPrefix(er.Page, "/") {
+			return c, fmt.Errorf("customErrorResponses: page %q for %d must start with '/'", er.Page, code)
+		}
+		if er.ResponseCode != 0 && er.ResponseCode != 200 && !containsInt(errorCodes, er.ResponseCode) {
+			return c, fmt.Errorf("customErrorResponses: responseCode %d for %d must be 200 or one of %v", er.ResponseCode, code, errorCodes)
+		}
+		if er.ResponseCode != 0 && er.Page == "" {
+			return c, fmt.Errorf("customErrorResponses: responseCode for %d requires a page", code)
+		}
+		if er.Ttl != nil && *er.Ttl < 0 {
+			return c, fmt.Errorf("customErrorResponses: ttl for %d must not be negative", code)
+		}
+		c.customErrorResponses[code] = er
+	}
+
+	c.errorDocumentTtl, err = getInt(cfg, "errorDocumentTtl", 30)
+	if err != nil {
+		return c, err
+	}
+	if c.errorDocumentTtl < 0 {
+		return c, fmt.Errorf("errorDocumentTtl: must not be negative, got %d", c.errorDocumentTtl)
+	}
+
+	// S3 answers 403 rather than 404 for missing objects, as CloudFront
+	// can not list the bucket, so a 403 is answered with the error
+	// document unless `customErrorResponses` maps it. Custom origins can
+	// answer 403 themselves, so they turn it off by default.
+	forbidden := cfg.Get("forbiddenErrorResponse")
+	if forbidden == "" {
+		forbidden = "404"
+		if c.apiOrigin.DomainName != "" || c.previewOrigin.DomainName != "" {
+			forbidden = "none"
+		}
+		for _, origin := range c.origins {
+			if origin.Type == "custom" {
+				forbidden = "none"
+			}
+		}
+	}
+	switch forbidden {
+	case "404":
+		c.forbiddenResponseCode = 404
+	case "403":
+		c.forbiddenResponseCode = 403
+	case "none":
+	default:
+		return c, fmt.Errorf("forbiddenErrorResponse: must be 404, 403 or none, got %q", forbidden)
+	}
+
+	// Without the error document of the bucket website, errors are only
+	// handled by `customErrorResponses`, so one of them must have a page.
+	c.noBucketErrorDocument, err = getBool(cfg, "noBucketErrorDocument", false)
+	if err != nil {
+		return c, err
+	}
+	if c.noBucketErrorDocument {
+		handled := false
+		for _, er := range c.customErrorResponses {
+			if er.Page != "" {
+				handled = true
+			}
+		}
+		if !handled {
+			return c, fmt.Errorf("noBucketErrorDocument: requires a customErrorResponses entry with a page")
+		}
+	}
+
+	// The bucket website endpoint routes requests on their Host header,
+	// so the bucket must be named after the hostname it serves. The
+	// settings below only apply to CloudFront.
+	if c.cdn == "none" {
+		if c.bucketNameSuffix != "none" || !contains(hostnames, c.bucketName) {
+			return c, fmt.Errorf("cdn: none requires the bucket to be named after one of %v, without bucketNameSuffix", hostnames)
+		}
+		if c.ipStack == "v6only" {
+			return c, fmt.Errorf("cdn: none can not be combined with ipStack v6only, as S3 website endpoints are IPv4 only")
+		}
+		cloudfrontOnly := []struct {
+			name string
+			set  bool
+		}{
+			{"certificateArn", c.certificateArn != ""},
+			{"reuseExistingCert", c.reuseExistingCert},
+			{"iamCertificateId", c.iamCertificateId != ""},
+			{"contentSecurityPolicy", c.contentSecurityPolicy.Enabled()},
+			{"customResponseHeaders", len(c.customResponseHeaders) > 0},
+			{"canonicalLinkHeader", c.canonicalLinkHeader},
+			{"originShield", c.originShield != ""},
+			{"mountPath", c.mountPath != ""},
+			{"perHostRootObject", len(c.perHostRootObject) > 0},
+			{"customErrorResponses", len(c.customErrorResponses) > 0},
+			{"noCachePaths", len(c.noCachePaths) > 0},
+			{"immutableAssets", c.immutableAssets.Enabled},
+			{"canonicalize", c.canonicalize.Enabled()},
+			{"basicAuth", c.basicAuth != (BasicAuth{})},
+			{"requestId", c.requestId.Enabled},
+			{"privateContent", c.privateContent.Enabled},
+			{"apiOrigin", c.apiOrigin.DomainName != ""},
+			{"previewOrigin", c.previewOrigin.DomainName != ""},
+			{"routes", len(c.routes) > 0},
+			{"geoRestriction", c.geoRestriction.Type != "none"},
+			{"realtimeLogs", c.realtimeLogs.Enabled},
+			{"enhancedMetrics", c.enhancedMetrics},
+			{"errorAlarm", c.errorAlarm.Enabled},
+			{"prewarm", c.prewarm.Enabled},
+		}
+		for _, setting := range cloudfrontOnly {
+			if setting.set {
+				return c, fmt.Errorf("cdn: none can not be combined with %s, which needs CloudFront", setting.name)
+			}
+		}
+	}
+
+	// With `externalRedirect` the bucket website endpoint redirects every
+	// request to another site, which S3 only accepts as a protocol and a
+	// hostname. No content is uploaded, so content settings do not apply.
+	if redirect := cfg.Get("externalRedirect"); redirect != "" {
+		u, err := url.Parse(redirect)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Port() != "" || u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			return c, fmt.Errorf("externalRedirect: %q must be https:// or http:// followed by a hostname only", redirect)
+		}
+		if err := validateDomain(u.Host); err != nil {
+			return c, fmt.Errorf("externalRedirect: %w", err)
+		}
+		if contains(hostnames, u.Host) {
+			return c, fmt.Errorf("externalRedirect: %s is served by the website itself", u.Host)
+		}
+		c.externalRedirect = u.Scheme + "://" + u.Host
+		contentOnly := []struct {
+			name string
+			set  bool
+		}{
+			{"cdn: none", c.cdn == "none"},
+			{"underConstruction", c.underConstruction},
+			{"customErrorResponses", len(c.customErrorResponses) > 0},
+			{"perHostRootObject", len(c.perHostRootObject) > 0},
+			{"generateSeoFiles", c.generateSeoFiles},
+			{"prewarm", c.prewarm.Enabled},
+			{"mountPath", c.mountPath != ""},
+		}
+		for _, setting := range contentOnly {
+			if setting.set {
+				return c, fmt.Errorf("externalRedirect: can not be combined with %s", setting.name)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// behaviorPatterns returns the path patterns of every ordered cache
+// behavior configured so far, which must be unique.
+func (c Config) behaviorPatterns() []string {
+	patterns := append([]string{}, c.noCachePaths...)
+	if c.immutableAssets.Enabled {
+		patterns = append(patterns, c.immutableAssets.PathPatterns...)
+	}
+	if c.privateContent.Enabled {
+		patterns = append(patterns, c.privateContent.PathPatterns...)
+	}
+	if c.apiOrigin.DomainName != "" {
+		patterns = append(patterns, c.apiOrigin.PathPattern)
+	}
+	if c.previewOrigin.DomainName != "" {
+		patterns = append(patterns, c.previewOrigin.PathPattern)
+	}
+	for _, route := range c.routes {
+		patterns = append(patterns, route.PathPattern)
+	}
+	return patterns
+}
+
+// languageTagRe matches a well-formed BCP 47 language tag: a language,
+// with optional script, region and variant subtags.
+var languageTagRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z]{4})?(-[A-Za-z]{2}|-[0-9]{3})?(-[A-Za-z0-9]{5,8}|-[0-9][A-Za-z0-9]{3})*$`)
+
+// nameTagFields are the placeholders `nameTagFormat` can contain.
+var nameTagFields = []string{"project", "environment", "host", "resource"}
+
+// nameTagFieldRe matches a placeholder of `nameTagFormat`.
+var nameTagFieldRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// headerNameRe matches an HTTP header name.
+var headerNameRe = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+$`)
+
+// reservedOriginHeaders are the headers CloudFront does not allow as
+// custom origin headers, in lowercase.
+var reservedOriginHeaders = []string{
+	"cache-control", "connection", "content-length", "cookie", "host", "if-match",
+	"if-modified-since", "if-none-match", "if-range", "if-unmodified-since", "max-forwards",
+	"pragma", "proxy-authorization", "proxy-connection", "range", "request-range", "te",
+	"trailer", "transfer-encoding", "upgrade", "via", "x-real-ip",
+}
+
+// mountPathRe matches a URL path of one or more segments that need no
+// percent-encoding, such as `/docs` or `/docs/v2`.
+var mountPathRe = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// queryStringNameRe matches a query string parameter name that needs no
+// percent-encoding, such as `v` or `utm_source`.
+var queryStringNameRe = regexp.MustCompile(`^[A-Za-z0-9._~\[\]-]+$`)
+
+// maxCacheQueryStrings is the default CloudFront quota of query strings in
+// the cache key of a cache policy.
+const maxCacheQueryStrings = 10
+
+// cacheControlDirectives are the Cache-Control response directives, mapped
+// to whether they take a number of seconds.
+var cacheControlDirectives = map[string]bool{
+	"max-age": true, "s-maxage": true, "stale-while-revalidate": true, "stale-if-error": true,
+	"immutable": false, "must-revalidate": false, "must-understand": false, "no-cache": false,
+	"no-store": false, "no-transform": false, "private": false, "proxy-revalidate": false,
+	"public": false,
+}
+
+// validateCacheControl checks that value is a list of known Cache-Control
+// directives, with a number of seconds for those that take one.
+func validateCacheControl(value string) error {
+	seen := map[string]bool{}
+	for _, directive := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		name, hasArg := strings.ToLower(parts[0]), len(parts) == 2
+		seconds, known := cacheControlDirectives[name]
+		switch {
+		case !known:
+			return fmt.Errorf("%q is not a Cache-Control directive", directive)
+		case seen[name]:
+			return fmt.Errorf("%s is set more than once", name)
+		case seconds && !hasArg:
+			return fmt.Errorf("%s requires a number of seconds", name)
+		case !seconds && hasArg:
+			return fmt.Errorf("%s takes no value", name)
+		}
+		if seconds {
+			if n, err := strconv.Atoi(parts[1]); err != nil || n < 0 {
+				return fmt.Errorf("%s must be a number of seconds, got %q", name, parts[1])
+			}
+		}
+		seen[name] = true
+	}
+	if (seen["stale-while-revalidate"] || seen["stale-if-error"]) && !seen["max-age"] && !seen["s-maxage"] {
+		return fmt.Errorf("stale-while-revalidate and stale-if-error require max-age or s-maxage")
+	}
+	return nil
+}
+
+// validateOriginProtocolPolicy checks the originProtocolPolicy of the
+// custom origin configured by field, and returns it with the https-only
+// default applied.
+func validateOriginProtocolPolicy(field, value string) (string, error) {
+	switch value {
+	case "":
+		return "https-only", nil
+	case "https-only", "http-only", "match-viewer":
+		return value, nil
+	}
+	return "", fmt.Errorf("%s: originProtocolPolicy must be one of https-only, http-only or match-viewer, got %q", field, value)
+}
+
+// reservedResponseHeaders are the security headers, which a response
+// headers policy sets through its own settings rather than as custom
+// headers.
+var reservedResponseHeaders = []string{
+	"content-security-policy", "referrer-policy", "strict-transport-security",
+	"x-content-type-options", "x-frame-options", "x-xss-protection",
+}
+
+// validateCustomHeader checks that name can be sent as a custom header to
+// a CloudFront origin.
+func validateCustomHeader(name string) error {
+	lower := strings.ToLower(name)
+	if !headerNameRe.MatchString(name) {
+		return fmt.Errorf("%q is not a valid header name", name)
+	}
+	if contains(reservedOriginHeaders, lower) || strings.HasPrefix(lower, "x-amz-") || strings.HasPrefix(lower, "x-edge-") {
+		return fmt.Errorf("%s can not be set as a custom origin header", name)
+	}
+	return nil
+}
+
+// validateRootObject checks that root can be both the default root object
+// of a distribution and the index document suffix of the bucket website,
+// which can not contain a '/'.
+func validateRootObject(root string) error {
+	if strings.Contains(root, "/") {
+		return fmt.Errorf("%q must be a file name at the root of the site, without '/'", root)
+	}
+	return nil
+}
+
+// iamCertificateIdRe matches the ID of an IAM server certificate.
+var iamCertificateIdRe = regexp.MustCompile(`^[A-Z0-9]{16,128}$`)
+
+// continentCodes are the continents of Route53 geolocation routing.
+var continentCodes = []string{"AF", "AN", "AS", "EU", "NA", "OC", "SA"}
+
+// regionRe matches the name of an AWS region, such as `eu-west-1`.
+var regionRe = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-[0-9]$`)
+
+// validateRoutingPolicy defaults the policy type to simple and checks that
+// exactly the fields its type needs are set.
+func validateRoutingPolicy(p *RoutingPolicy) error {
+	if p.Type == "" {
+		p.Type = "simple"
+	}
+	if p.Type == "simple" {
+		if *p != (RoutingPolicy{Type: "simple"}) {
+			return fmt.Errorf("simple takes no other fields")
+		}
+		return nil
+	}
+	if p.SetIdentifier == "" || len(p.SetIdentifier) > 128 {
+		return fmt.Errorf("%s requires a setIdentifier of at most 128 characters, unique among the records of the hostnames", p.Type)
+	}
+	latency := p.Region != ""
+	geolocation := p.Continent != "" || p.Country != "" || p.Subdivision != ""
+	weighted := p.Weight != nil
+	switch p.Type {
+	case "latency":
+		if !regionRe.MatchString(p.Region) || geolocation || weighted {
+			return fmt.Errorf("latency requires region, such as eu-west-1, and no other policy fields")
+		}
+	case "geolocation":
+		if latency || weighted {
+			return fmt.Errorf("geolocation takes continent, country and subdivision only")
+		}
+		if (p.Continent == "") == (p.Country == "") {
+			return fmt.Errorf("geolocation requires exactly one of continent or country")
+		}
+		if p.Continent != "" && !contains(continentCodes, p.Continent) {
+			return fmt.Errorf("continent must be one of %s, got %q", strings.Join(continentCodes, ", "), p.Continent)
+		}
+		if p.Country != "" && p.Country != "*" && !countryCodeRe.MatchString(p.Country) {
+			return fmt.Errorf("country must be an ISO 3166-1 alpha-2 code or *, got %q", p.Country)
+		}
+		if p.Subdivision != "" && (p.Country == "" || p.Country == "*") {
+			return fmt.Errorf("subdivision requires country")
+		}
+	case "weighted":
+		if !weighted || *p.Weight < 0 || *p.Weight > 255 || latency || geolocation {
+			return fmt.Errorf("weighted requires a weight between 0 and 255 and no other policy fields")
+		}
+	default:
+		return fmt.Errorf("type must be simple, latency, geolocation or weighted, got %q", p.Type)
+	}
+	return nil
+}
+
+// pathPatternRe matches the characters CloudFront allows in the path
+// pattern of a cache behavior.
+var pathPatternRe = regexp.MustCompile(`^/[A-Za-z0-9_\-.*$/~"'@:+&?]*$`)
+
+// validatePathPatterns checks that every pattern is a valid, unique
+// CloudFront cache behavior path pattern.
+func validatePathPatterns(patterns []string) error {
+	seen := []string{}
+	for _, pattern := range patterns {
+		if len(pattern) > 255 || !pathPatternRe.MatchString(pattern) {
+			return fmt.Errorf("%q is not a valid path pattern, it must start with '/' and be at most 255 characters", pattern)
+		}
+		if contains(seen, pattern) {
+			return fmt.Errorf("%q is listed more than once", pattern)
+		}
+		seen = append(seen, pattern)
+	}
+	return nil
+}
+
+// validatePublicKey checks that key is a PEM encoded RSA public key, the
+// only kind CloudFront accepts for signed URLs and cookies.
+func validatePublicKey(key string) error {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return fmt.Errorf("publicKey is not PEM encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("publicKey: %w", err)
+	}
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		return fmt.Errorf("publicKey must be an RSA key")
+	}
+	return nil
+}
+
+// stackNameRe matches the characters a stack name may contain that are
+// not allowed in a bucket name.
+var stackNameRe = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// bucketNameRe matches the characters and layout S3 allows in a bucket name.
+var bucketNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)
+
+// validateBucketName checks that name follows the S3 bucket naming rules
+// so the mistake is reported before any resources are created.
+func validateBucketName(name string) error {
+	if len(name) < 3 || len(name) > 63 {
+		return fmt.Errorf("bucket name %q must be between 3 and 63 characters long", name)
+	}
+	if !bucketNameRe.MatchString(name) {
+		return fmt.Errorf("bucket name %q may only contain lowercase letters, numbers, dots and hyphens and must start and end with a letter or number", name)
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, ".-") || strings.Contains(name, "-.") {
+		return fmt.Errorf("bucket name %q must not contain adjacent dots or a dot next to a hyphen", name)
+	}
+	if net.ParseIP(name) != nil {
+		return fmt.Errorf("bucket name %q must not be formatted as an IP address", name)
+	}
+	return nil
+}
+
+// SiteEntry stores one of the websites listed in the `sites` config.
+type SiteEntry struct {
+	Name      string                     `json:"name"`
+	Domain    string                     `json:"domain"`
+	SiteDir   string                     `json:"siteDir"`
+	Overrides map[string]json.RawMessage `json:"overrides"`
+}
+
+// siteNameRe matches the names allowed for a site, which are used in the
+// resource names of everything provisioned for it.
+var siteNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// loadSites reads the `sites` list from cfg. An empty list means the
+// program provisions its single default website.
+func loadSites(cfg configSource) ([]SiteEntry, error) {
+	var sites []SiteEntry
+	if err := cfg.GetObject("sites", &sites); err != nil {
+		return nil, fmt.Errorf("sites: %w", err)
+	}
+	names := []string{}
+	domains := []string{}
+	for _, entry := range sites {
+		if !siteNameRe.MatchString(entry.Name) {
+			return nil, fmt.Errorf("sites: name %q may only contain lowercase letters, numbers and hyphens", entry.Name)
+		}
+		if contains(names, entry.Name) {
+			return nil, fmt.Errorf("sites: name %q is used more than once", entry.Name)
+		}
+		if entry.Domain == "" || entry.SiteDir == "" {
+			return nil, fmt.Errorf("sites: %q requires both domain and siteDir", entry.Name)
+		}
+		if contains(domains, entry.Domain) {
+			return nil, fmt.Errorf("sites: domain %q is used more than once", entry.Domain)
+		}
+		if _, ok := entry.Overrides["sites"]; ok {
+			return nil, fmt.Errorf("sites: %q can not override sites", entry.Name)
+		}
+		names = append(names, entry.Name)
+		domains = append(domains, entry.Domain)
+	}
+	return sites, nil
+}
+
+// siteConfig layers the overrides of a single site over the stack
+// configuration.
+type siteConfig struct {
+	overrides map[string]json.RawMessage
+	stack     configSource
+}
+
+// Get returns the override for key, falling back to the stack
+// configuration. String overrides are returned without their quotes.
+func (s siteConfig) Get(key string) string {
+	raw, ok := s.overrides[key]
+	if !ok {
+		return s.stack.Get(key)
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err == nil {
+		return v
+	}
+	return string(raw)
+}
+
+// GetObject decodes the override for key into output, falling back to the
+// stack configuration.
+func (s siteConfig) GetObject(key string, output interface{}) error {
+	if raw, ok := s.overrides[key]; ok {
+		return json.Unmarshal(raw, output)
+	}
+	return s.stack.GetObject(key, output)
+}
+
+// getInt returns the integer value of key, or def when key is not set.
+func getInt(cfg configSource, key string, def int) (int, error) {
+	v := cfg.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not an integer", key, v)
+	}
+	return i, nil
+}
+
+// getBool returns the boolean value of key, or def when key is not set.
+func getBool(cfg configSource, key string, def bool) (bool, error) {
+	v := cfg.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %q is not a boolean", key, v)
+	}
+	return b, nil
+}
+
+// containsInt reports whether i is present in list.
+func containsInt(list []int, i int) bool {
+	for _, item := range list {
+		if item == i {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether s is present in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Errors returned for the common failure modes, so that programs wrapping
+// this one with the automation API can tell them apart with errors.Is.
+var (
+	// ErrZoneNotFound is returned when the Route53 hosted zone for the
+	// domain can not be found.
+	ErrZoneNotFound = errors.New("route53 hosted zone not found")
+
+	// ErrSiteDirMissing is returned when the website directory does not
+	// exist or is not a directory.
+	ErrSiteDirMissing = errors.New("site directory missing")
+
+	// ErrSiteTooSmall is returned when the website directory holds no
+	// files to upload, or fewer than `minFileCount`.
+	ErrSiteTooSmall = errors.New("site has too few files")
+
+	// ErrInvalidDomain is returned when the domain name is not a valid
+	// DNS name.
+	ErrInvalidDomain = errors.New("invalid domain name")
+
+	// ErrCertWrongRegion is returned when an existing certificate is
+	// outside of us-east-1, where CloudFront requires it to be.
+	ErrCertWrongRegion = errors.New("certificate must be in us-east-1")
+
+	// ErrAliasNotCovered is returned when a distribution alias is not
+	// covered by the names of the certificate it is served with.
+	ErrAliasNotCovered = errors.New("alias not covered by the certificate")
+
+	// ErrDeployLocked is returned by `deployLock` when a deployment of
+	// different content took the lock of the bucket within the lock
+	// timeout and has not released it.
+	ErrDeployLocked = errors.New("bucket locked by another deployment")
+
+	// ErrPartitionUnsupported is returned when the AWS partition of the
+	// provider has no CloudFront that the website can be served from.
+	ErrPartitionUnsupported = errors.New("AWS partition not supported")
+)
+
+// domainLabelRe matches a single label of a DNS name.
+var domainLabelRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// validateDomain checks that name is a lowercase DNS name with at least
+// two labels.
+func validateDomain(name string) error {
+	labels := strings.Split(name, ".")
+	if len(name) > 253 || len(labels) < 2 {
+		return fmt.Errorf("%w: %q", ErrInvalidDomain, name)
+	}
+	for _, label := range labels {
+		if !domainLabelRe.MatchString(label) {
+			return fmt.Errorf("%w: %q", ErrInvalidDomain, name)
+		}
+	}
+	return nil
+}
+
+// notFoundMarkers are the parts of the errors S3 lookups fail with when
+// the bucket or object does not exist, as opposed to any other failure.
+var notFoundMarkers = []string{"NotFound", "NoSuchBucket", "NoSuchKey", "status code: 404"}
+
+// isNotFound reports whether err, returned by a lookup through the AWS
+// provider, means the bucket or object does not exist.
+func isNotFound(err error) bool {
+	for _, marker := range notFoundMarkers {
+		if strings.Contains(err.Error(), marker) {
+			return true
+		}
+	}
+	return false
+}
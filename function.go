@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"text/template"
+)
+
+// functionTemplates holds the CloudFront Function code, rendered with the
+// settings that enable each part of it.
+//
+//go:embed functions/*.js
+var functionTemplates embed.FS
+
+// renderFunction renders the named CloudFront Function template with data.
+func renderFunction(name string, data interface{}) (string, error) {
+	tmpl, err := template.ParseFS(functionTemplates, "functions/"+name)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,18 @@
+// Asks for HTTP basic auth credentials before serving any request. This
+// only keeps casual visitors out, the credentials are sent with every
+// request and are visible to anyone who can read the function code.
+function handler(event) {
+    var request = event.request;
+    var authorization = request.headers.authorization;
+
+    if (authorization && authorization.value === 'Basic {{.Credentials}}') {
+        return request;
+    }
+    return {
+        statusCode: 401,
+        statusDescription: 'Unauthorized',
+        headers: {
+            'www-authenticate': { value: 'Basic realm="{{js .Realm}}", charset="UTF-8"' }
+        }
+    };
+}
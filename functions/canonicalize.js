@@ -0,0 +1,67 @@
+// Canonicalizes the request URI so every page is reachable at a single URL.
+// Requests for a non-canonical URI are redirected to the canonical one, and
+// directory requests are rewritten to their index document for the S3 origin.
+function handler(event) {
+    var request = event.request;
+    var uri = request.uri;
+
+    // Well-known files are fetched by exact path, mostly by machines.
+    if (uri.indexOf('/.well-known/') === 0) {
+        return request;
+    }
+
+    var canonical = uri;
+{{- if .Lowercase}}
+
+    // Force a lowercase path.
+    canonical = canonical.toLowerCase();
+{{- end}}
+{{- if .StripIndex}}
+
+    // Strip the index document from directory URLs.
+    canonical = canonical.replace(/\/index\.html$/, '/');
+{{- end}}
+{{- if eq .TrailingSlash "add"}}
+
+    // Add a trailing slash to paths without a file extension.
+    if (!/\/$/.test(canonical) && !/\.[^\/]*$/.test(canonical)) {
+        canonical = canonical + '/';
+    }
+{{- else if eq .TrailingSlash "remove"}}
+
+    // Remove the trailing slash from everything but the root.
+    if (canonical.length > 1 && /\/$/.test(canonical)) {
+        canonical = canonical.slice(0, -1);
+    }
+{{- end}}
+
+    if (canonical !== uri) {
+        var params = [];
+        for (var key in request.querystring) {
+            var qs = request.querystring[key];
+            if (qs.multiValue) {
+                qs.multiValue.forEach(function (v) {
+                    params.push(key + '=' + v.value);
+                });
+            } else {
+                params.push(qs.value ? key + '=' + qs.value : key);
+            }
+        }
+        return {
+            statusCode: 301,
+            statusDescription: 'Moved Permanently',
+            headers: {
+                location: { value: params.length ? canonical + '?' + params.join('&') : canonical }
+            }
+        };
+    }
+
+    // The S3 origin only serves exact keys, so directory requests are
+    // rewritten to the directory's index document.
+    if (/\/$/.test(uri)) {
+        request.uri = uri + 'index.html';
+    } else if (!/\.[^\/]*$/.test(uri)) {
+        request.uri = uri + '/index.html';
+    }
+    return request;
+}
@@ -0,0 +1,13 @@
+// Adds a Link header naming the canonical URL of the page, so that search
+// engines index a single URL for it whichever hostname served it.
+function handler(event) {
+    var response = event.response;
+    if (response.statusCode !== 200) {
+        return response;
+    }
+
+    // Directory URLs are canonical without their index document.
+    var path = event.request.uri.replace(/\/index\.html$/, '/');
+    response.headers['link'] = { value: '<{{.CanonicalUrl}}' + path + '>; rel="canonical"' };
+    return response;
+}
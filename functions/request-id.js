@@ -0,0 +1,14 @@
+// Tags each request with the ID CloudFront gives it, the x-edge-request-id
+// of the access logs, so a client report can be matched with the logs and
+// with the origin. The same ID is echoed back on the response.
+function handler(event) {
+    var id = event.context.requestId;
+    if (event.context.eventType === 'viewer-response') {
+        var response = event.response;
+        response.headers['{{.Header}}'] = { value: id };
+        return response;
+    }
+    var request = event.request;
+    request.headers['{{.Header}}'] = { value: id };
+    return request;
+}
@@ -0,0 +1,38 @@
+package main
+
+// Countries by the CloudFront edge coverage of the price classes, as ISO
+// 3166-1 alpha-2 codes.
+var (
+	// priceClass100Countries are served by the edges in North America,
+	// Europe and Israel included in every price class.
+	priceClass100Countries = []string{
+		"US", "CA", "MX",
+		"AD", "AL", "AT", "BA", "BE", "BG", "BY", "CH", "CY", "CZ", "DE", "DK",
+		"EE", "ES", "FI", "FO", "FR", "GB", "GG", "GI", "GR", "HR", "HU", "IE",
+		"IM", "IS", "IT", "JE", "LI", "LT", "LU", "LV", "MC", "MD", "ME", "MK",
+		"MT", "NL", "NO", "PL", "PT", "RO", "RS", "RU", "SE", "SI", "SK", "SM",
+		"UA", "VA", "XK",
+		"IL",
+	}
+
+	// priceClassAllCountries are only served by nearby edges, in South
+	// America and Oceania, with PriceClass_All.
+	priceClassAllCountries = []string{
+		"AR", "BO", "BR", "CL", "CO", "EC", "FK", "GF", "GY", "PE", "PY", "SR",
+		"UY", "VE",
+		"AU", "NZ", "CK", "FJ", "FM", "KI", "MH", "NC", "NR", "NU", "PF", "PG",
+		"PW", "SB", "TO", "TV", "VU", "WS",
+	}
+)
+
+// priceClassCovers reports whether priceClass includes edge locations near
+// the country with the given code.
+func priceClassCovers(priceClass, country string) bool {
+	switch priceClass {
+	case "PriceClass_100":
+		return contains(priceClass100Countries, country)
+	case "PriceClass_200":
+		return !contains(priceClassAllCountries, country)
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// deployLockPrefix is the prefix of the lock and release objects, which
+// the bucket policy denies to viewers.
+const deployLockPrefix = ".deploy-lock/"
+
+// deployLockKey is the key of the lock object.
+const deployLockKey = deployLockPrefix + "lock"
+
+// deployLockReleaseKey is the key of the release object, a copy of the
+// lock object written once the deployment that took the lock completed.
+const deployLockReleaseKey = deployLockPrefix + "released"
+
+// DeployLock is the content of the lock object, naming the owner that
+// deploys to the bucket and the digest of the content it deploys. Both
+// only change with the deployment, so the lock object is not rewritten
+// by a deployment that changes no content.
+type DeployLock struct {
+	Owner   string `json:"owner"`
+	Content string `json:"content"`
+}
+
+// deployLockBody returns the content of the lock object for owner
+// deploying the content with the digest content.
+func deployLockBody(owner string, content string) (string, error) {
+	body, err := json.Marshal(DeployLock{
+		Owner:   owner,
+		Content: content,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// contentDigest returns a SHA-256 over each key and the hash of its file,
+// in the order of keys, identifying the content of a deployment.
+func contentDigest(keys []string, hashes map[string]string) string {
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s %s\n", key, hashes[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkDeployLock returns ErrDeployLocked when body, the lock object last
+// modified at modified, is younger than timeout at now, differs from own,
+// the lock of this deployment, and was not released by a release object
+// with the content released. A lock that can not be read is taken over,
+// as is one that has expired.
+func checkDeployLock(body string, modified string, released string, own string, now time.Time, timeout time.Duration) error {
+	var lock, release, ours DeployLock
+	if err := json.Unmarshal([]byte(body), &lock); err != nil || lock.Owner == "" {
+		return nil
+	}
+	if json.Unmarshal([]byte(own), &ours) == nil && lock == ours {
+		return nil
+	}
+	if json.Unmarshal([]byte(released), &release) == nil && lock == release {
+		return nil
+	}
+	acquired, err := parseLastModified(modified)
+	if err != nil {
+		return nil
+	}
+	if age := now.Sub(acquired); age < timeout {
+		return fmt.Errorf("%w: held by %s since %s, retry after %s", ErrDeployLocked, lock.Owner, acquired.Format(time.RFC3339), acquired.Add(timeout).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseLastModified parses the last modified time of an S3 object, which
+// the provider returns in the format of RFC 1123.
+func parseLastModified(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC1123, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a last modified time", value)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckDeployLock(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-10 * time.Minute).Format(time.RFC1123)
+	old := now.Add(-2 * time.Hour).Format(time.RFC1123)
+	lock, err := deployLockBody("alice", "digest-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := deployLockBody("bob", "digest-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameOwner, err := deployLockBody("alice", "digest-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		body     string
+		modified string
+		released string
+		own      string
+		wantErr  bool
+	}{
+		{"no lock", "", "", "", other, false},
+		{"unreadable lock", "not json", recent, "", other, false},
+		{"held by another owner", lock, recent, "", other, true},
+		{"held by the same owner for other content", lock, recent, "", sameOwner, true},
+		{"held by this deployment", lock, recent, "", lock, false},
+		{"released", lock, recent, lock, other, false},
+		{"released by an earlier deployment", lock, recent, other, sameOwner, true},
+		{"expired", lock, old, "", other, false},
+		{"unreadable last modified", lock, "yesterday", "", other, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDeployLock(tt.body, tt.modified, tt.released, tt.own, now, time.Hour)
+			if got := errors.Is(err, ErrDeployLocked); got != tt.wantErr {
+				t.Errorf("checkDeployLock() = %v, want locked %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContentDigest(t *testing.T) {
+	keys := []string{"about.html", "index.html"}
+	base := contentDigest(keys, map[string]string{"about.html": "a", "index.html": "b"})
+	if got := contentDigest(keys, map[string]string{"index.html": "b", "about.html": "a"}); got != base {
+		t.Errorf("contentDigest is not stable: %s != %s", got, base)
+	}
+	if got := contentDigest(keys, map[string]string{"about.html": "a", "index.html": "c"}); got == base {
+		t.Error("contentDigest did not change with a file")
+	}
+}
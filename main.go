@@ -2,14 +2,12 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
+	"regexp"
 
-	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/acm"
-	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/cloudfront"
-	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/iam"
-	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/route53"
-	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/s3"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
 
 // Structs to store a data.
@@ -21,10 +19,17 @@ type Environment struct {
 	name string
 }
 
+// Site is the content of the website. Files are read from dir on disk,
+// unless files is set, such as to an `embed.FS` compiled into the program.
 type Site struct {
-	dir string
+	dir   string
+	files fs.FS
 }
 
+// environmentNameRe matches an environment name that can be used in the
+// names of the resources, such as those of the CloudFront Functions.
+var environmentNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
 type Domain struct {
 	name string
 }
@@ -33,6 +38,21 @@ type Tags struct {
 	tags map[string]string
 }
 
+// Distribution stores the settings that can differ between the
+// CloudFront distributions serving the website.
+type Distribution struct {
+	aliases    []string
+	rootObject string
+	originPath string
+}
+
+// Partition stores the values that differ between AWS partitions.
+type Partition struct {
+	name              string
+	dnsSuffix         string
+	certificateRegion string
+}
+
 type WebBucket struct {
 	name          string
 	indexDocument string
@@ -49,8 +69,17 @@ func main() {
 			name: "stratusLabs",
 		}
 
+		// The environment is the name of the stack, such as `dev` or
+		// `prod`, unless `environment` names it. It selects the entries of
+		// the `*ByEnv` settings and is part of the resource names.
 		environment := Environment{
-			name: "dev",
+			name: ctx.Stack(),
+		}
+		if name := config.Get(ctx, "environment"); name != "" {
+			environment.name = name
+		}
+		if !environmentNameRe.MatchString(environment.name) {
+			return fmt.Errorf("environment: %q must be 1-32 letters, digits, '-' or '_', set it with `pulumi config set environment`", environment.name)
 		}
 
 		site := Site{
@@ -78,268 +107,169 @@ func main() {
 			priceClass = "PriceClass_100"
 		}
 
-		wb := WebBucket{
-			name:          fmt.Sprintf("www.%s", domain.name),
-			indexDocument: "index.html",
-			errorDocument: "error.html",
-		}
-
-		// Website Files
-		// -------------
-		// Load the file to transfer to the websites S3 bucket.
-		files, err := os.ReadDir(fmt.Sprintf("%s/", site.dir))
+		// Stack Configuration
+		// -------------------
+		cfg := config.New(ctx, "")
+		sites, err := loadSites(cfg)
 		if err != nil {
 			return err
 		}
 
-		// Domain Name
-		// -----------
-		// Load the instance of the domain name that was purchased for the website.
-		domainZone, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
-			Name: pulumi.StringRef(domain.name),
-		}, nil)
-		if err != nil {
-			return err
+		// Each environment can be served on its own hostname, such as
+		// `dev.example.com` for dev, through `domainByEnv`. A `domain`
+		// overrides it for the stack.
+		domainByEnv := map[string]string{}
+		if err := cfg.GetObject("domainByEnv", &domainByEnv); err != nil {
+			return fmt.Errorf("domainByEnv: %w", err)
+		}
+		if name, ok := domainByEnv[environment.name]; ok {
+			domain.name = name
+		}
+		if name := cfg.Get("domain"); name != "" {
+			domain.name = name
 		}
 
-		// S3
-		// --
-		// Create an S3 bucket and enalbe Web Hosting in order to host the website.
-		bucket, err := s3.NewBucket(ctx, fmt.Sprintf("%sBucket", project.name), &s3.BucketArgs{
-			Bucket: pulumi.String(wb.name),
-			Website: &s3.BucketWebsiteArgs{
-				IndexDocument: pulumi.String(wb.indexDocument),
-				ErrorDocument: pulumi.String(wb.errorDocument),
-			},
-			Tags: pulumi.ToStringMap(tags.tags),
-		})
+		// Preflight
+		// ---------
+		// Fail fast with a clear message when the AWS credentials or region
+		// are unusable, rather than part way through creating resources.
+		callerIdentity, err := aws.GetCallerIdentity(ctx, nil, nil)
+		if err != nil {
+			return fmt.Errorf("AWS credentials not found or expired: %w", err)
+		}
+		currentPartition, err := aws.GetPartition(ctx, nil, nil)
+		if err != nil {
+			return fmt.Errorf("AWS partition could not be determined: %w", err)
+		}
+		partition, err := lookupPartition(currentPartition.Partition, currentPartition.DnsSuffix)
 		if err != nil {
 			return err
 		}
-
-		// Make bucket private. This blocks all access directly to the bucket.
-		// Access will be permitted for CloudFront to the bucket via a bucket policy.
-		_, err = s3.NewBucketPublicAccessBlock(ctx, fmt.Sprintf("%sBucketNoPublic", project.name), &s3.BucketPublicAccessBlockArgs{
-			Bucket:                bucket.ID(),
-			BlockPublicAcls:       pulumi.Bool(true),
-			BlockPublicPolicy:     pulumi.Bool(true),
-			IgnorePublicAcls:      pulumi.Bool(true),
-			RestrictPublicBuckets: pulumi.Bool(true),
-		})
+		region, err := aws.GetRegion(ctx, nil, nil)
+		if err != nil {
+			return fmt.Errorf("AWS region could not be determined, set it with `pulumi config set aws:region %s`: %w", partition.certificateRegion, err)
+		}
+		// CloudFront allows few CreateDistribution calls per second, so
+		// programs creating many sites at once can be throttled. With
+		// `awsMaxRetries` the resources are created through an explicit
+		// provider that retries throttled calls that many times with
+		// backoff. The provider is given the region and profile of the
+		// stack, as explicit providers do not read the `aws:` settings.
+		maxRetries, err := getInt(cfg, "awsMaxRetries", -1)
 		if err != nil {
 			return err
 		}
+		if cfg.Get("awsMaxRetries") != "" && maxRetries < 0 {
+			return fmt.Errorf("awsMaxRetries: must not be negative, got %d", maxRetries)
+		}
+		newProvider := func(name, region string) (pulumi.ProviderResource, error) {
+			providerArgs := &aws.ProviderArgs{
+				Region: pulumi.String(region),
+			}
+			if maxRetries >= 0 {
+				providerArgs.MaxRetries = pulumi.Int(maxRetries)
+			}
+			if profile := config.Get(ctx, "aws:profile"); profile != "" {
+				providerArgs.Profile = pulumi.String(profile)
+			}
+			return aws.NewProvider(ctx, name, providerArgs)
+		}
+		var provider pulumi.ProviderResource
+		if maxRetries >= 0 {
+			provider, err = newProvider("aws", region.Name)
+			if err != nil {
+				return err
+			}
+		}
 
-		// Upload the website files to the bucket.
-		for _, file := range files {
-			_, err = s3.NewBucketObject(ctx, file.Name(), &s3.BucketObjectArgs{
-				Key:         pulumi.String(file.Name()),
-				Bucket:      bucket.ID(),
-				Source:      pulumi.NewFileAsset(fmt.Sprintf("%s/%s", site.dir, file.Name())),
-				ContentType: pulumi.String("text/html"),
-				Tags:        pulumi.ToStringMap(tags.tags),
-			})
+		// CloudFront only accepts ACM certificates issued in one region of
+		// the partition, us-east-1 for aws, and reports its metrics there.
+		// Stacks in another region create the certificates and alarms
+		// through a single provider in that region, created here once and
+		// passed to every StaticSite in its args.
+		certificateProvider := provider
+		if region.Name != partition.certificateRegion {
+			certificateProvider, err = newProvider("certificates", partition.certificateRegion)
 			if err != nil {
 				return err
 			}
 		}
 
-		// Certificate Manager
-		// -------------------
-		// Create a Public Certificate that will be used in the CloudFront distribution
-		// to enable TLS connections to the website.
+		// Exports will be shown as outputs to the terminal.
+		ctx.Export("accountId", pulumi.String(callerIdentity.AccountId))
 
-		certificate, err := acm.NewCertificate(ctx, fmt.Sprintf("%sCert", project.name), &acm.CertificateArgs{
-			DomainName:       pulumi.String(domain.name),
-			ValidationMethod: pulumi.String("DNS"),
-			SubjectAlternativeNames: pulumi.StringArray{
-				pulumi.String(fmt.Sprintf("www.%s", domain.name)),
-			},
-			Tags: pulumi.ToStringMap(tags.tags),
-		})
-		if err != nil {
-			return err
-		}
+		// Websites
+		// --------
+		// Each website is a StaticSite component. Without a `sites` list a
+		// single website is provisioned and its outputs are exported
+		// directly.
+		if len(sites) == 0 {
+			staticSite, err := NewStaticSite(ctx, project.name, StaticSiteArgs{
+				project:     project,
+				environment: environment,
+				site:        site,
+				domain:      domain,
+				tags:        tags,
+				priceClass:  priceClass,
+				partition:   partition,
+				provider:    provider,
+				config:      cfg,
 
-		// Add CNAME records to Route53. This is used to validate that we own
-		// the domain we are requesting certificates for.
-		for i := 0; i <= 1; i++ {
-			_, err := route53.NewRecord(ctx, fmt.Sprintf("%sCname%d", project.name, i), &route53.RecordArgs{
-				ZoneId: pulumi.String(domainZone.Id),
-				Name:   certificate.DomainValidationOptions.Index(pulumi.Int(i)).ResourceRecordName().Elem(),
-				Type:   pulumi.String("CNAME"),
-				Ttl:    pulumi.Int(60),
-				Records: pulumi.StringArray{
-					certificate.DomainValidationOptions.Index(pulumi.Int(i)).ResourceRecordValue().Elem(),
-				},
+				certificateProvider: certificateProvider,
 			})
 			if err != nil {
 				return err
 			}
+			for name, output := range staticSite.Outputs {
+				ctx.Export(name, output)
+			}
+			return nil
 		}
 
-		// CloudFront
-		// ----------
-		// Create a CloudFront Origin Access Identity.
-		// This is used to attach the CloudFront Distribution to an S3 bucket.
-		originAccessId, err := cloudfront.NewOriginAccessIdentity(ctx, fmt.Sprintf("%sOriginAccessId", project.name), &cloudfront.OriginAccessIdentityArgs{
-			Comment: pulumi.String(project.name),
-		})
-		if err != nil {
-			return err
-		}
-
-		// Create a CloudFront Distribution
-		cloudFrontDist, err := cloudfront.NewDistribution(ctx, fmt.Sprintf("%sDistribution", project.name), &cloudfront.DistributionArgs{
-			Origins: cloudfront.DistributionOriginArray{
-				&cloudfront.DistributionOriginArgs{
-					DomainName: bucket.BucketRegionalDomainName,
-					OriginId:   bucket.ID(),
-					S3OriginConfig: &cloudfront.DistributionOriginS3OriginConfigArgs{
-						OriginAccessIdentity: originAccessId.CloudfrontAccessIdentityPath,
-					},
-				},
-			},
-			Enabled:           pulumi.Bool(true),
-			HttpVersion:       pulumi.String("http2and3"),
-			IsIpv6Enabled:     pulumi.Bool(true),
-			DefaultRootObject: pulumi.String("index.html"),
-			// No logging config at the moment, this will be added as an
-			// option in the future
-			// LoggingConfig: &cloudfront.DistributionLoggingConfigArgs{
-			// 	IncludeCookies: pulumi.Bool(false),
-			// 	Bucket:         pulumi.String("mylogs.s3.amazonaws.com"),
-			// 	Prefix:         pulumi.String("myprefix"),
-			// },
-			Aliases: pulumi.StringArray{
-				pulumi.String(domain.name),
-				pulumi.String(fmt.Sprintf("www.%s", domain.name)),
-			},
-			DefaultCacheBehavior: &cloudfront.DistributionDefaultCacheBehaviorArgs{
-				AllowedMethods: pulumi.StringArray{
-					pulumi.String("GET"),
-					pulumi.String("HEAD"),
+		// Otherwise one component is provisioned per entry. Component and
+		// resource names are prefixed with the site name so that the sites
+		// never collide, and the outputs of every site are exported as a
+		// single map.
+		siteOutputs := pulumi.Map{}
+		for _, entry := range sites {
+			siteTags := Tags{
+				tags: map[string]string{
+					"site": entry.Name,
 				},
-				CachedMethods: pulumi.StringArray{
-					pulumi.String("GET"),
-					pulumi.String("HEAD"),
+			}
+			for k, v := range tags.tags {
+				siteTags.tags[k] = v
+			}
+			siteProject := Project{
+				name: fmt.Sprintf("%s-%s", project.name, entry.Name),
+			}
+			staticSite, err := NewStaticSite(ctx, siteProject.name, StaticSiteArgs{
+				project:     siteProject,
+				environment: environment,
+				site: Site{
+					dir: entry.SiteDir,
 				},
-				TargetOriginId: bucket.ID(),
-				ForwardedValues: &cloudfront.DistributionDefaultCacheBehaviorForwardedValuesArgs{
-					QueryString: pulumi.Bool(false),
-					Cookies: &cloudfront.DistributionDefaultCacheBehaviorForwardedValuesCookiesArgs{
-						Forward: pulumi.String("none"),
-					},
+				domain: Domain{
+					name: entry.Domain,
 				},
-				ViewerProtocolPolicy: pulumi.String("redirect-to-https"),
-				MinTtl:               pulumi.Int(0),
-				DefaultTtl:           pulumi.Int(3600),
-				MaxTtl:               pulumi.Int(86400),
-			},
-			PriceClass: pulumi.String(priceClass),
-			Restrictions: &cloudfront.DistributionRestrictionsArgs{
-				GeoRestriction: &cloudfront.DistributionRestrictionsGeoRestrictionArgs{
-					// Update this section to enable Geo-Restrictions.
-					RestrictionType: pulumi.String("none"),
-					// Locations: pulumi.StringArray{
-					// 	pulumi.String("US"),
-					// 	pulumi.String("CA"),
-					// 	pulumi.String("GB"),
-					// 	pulumi.String("DE"),
-					// },
+				tags:       siteTags,
+				priceClass: priceClass,
+				partition:  partition,
+				provider:   provider,
+				config: siteConfig{
+					overrides: entry.Overrides,
+					stack:     cfg,
 				},
-			},
-			ViewerCertificate: &cloudfront.DistributionViewerCertificateArgs{
-				CloudfrontDefaultCertificate: pulumi.Bool(false),
-				AcmCertificateArn:            certificate.Arn,
-				SslSupportMethod:             pulumi.String("sni-only"),
-				MinimumProtocolVersion:       pulumi.String("TLSv1.2_2021"),
-			},
-			Tags: pulumi.ToStringMap(tags.tags),
-		})
-		if err != nil {
-			return err
-		}
+				objectPrefix: fmt.Sprintf("%s/", entry.Name),
 
-		// Create DNS records for the website.
-		// The A/AAAA records are alias records that point to the
-		// CloudFront distribution. Records are created for both
-		// the bare domain `example.domain` and the `www.example.domain`
-		for _, record := range []string{"A", "AAAA"} {
-			_, err := route53.NewRecord(ctx, fmt.Sprintf("%s%s", project.name, record), &route53.RecordArgs{
-				ZoneId: pulumi.String(domainZone.Id),
-				Name:   pulumi.String(domain.name),
-				Type:   pulumi.String(record),
-				Aliases: route53.RecordAliasArray{
-					&route53.RecordAliasArgs{
-						Name:                 cloudFrontDist.DomainName,
-						ZoneId:               cloudFrontDist.HostedZoneId,
-						EvaluateTargetHealth: pulumi.Bool(true),
-					},
-				},
+				certificateProvider: certificateProvider,
 			})
 			if err != nil {
-				return err
-			}
-			_, err = route53.NewRecord(ctx, fmt.Sprintf("www%s%s", project.name, record), &route53.RecordArgs{
-				ZoneId: pulumi.String(domainZone.Id),
-				Name:   pulumi.String(fmt.Sprintf("www.%s", domain.name)),
-				Type:   pulumi.String(record),
-				Aliases: route53.RecordAliasArray{
-					&route53.RecordAliasArgs{
-						Name:                 cloudFrontDist.DomainName,
-						ZoneId:               cloudFrontDist.HostedZoneId,
-						EvaluateTargetHealth: pulumi.Bool(true),
-					},
-				},
-			})
-			if err != nil {
-				return err
+				return fmt.Errorf("site %s: %w", entry.Name, err)
 			}
+			siteOutputs[entry.Name] = staticSite.Outputs
 		}
-
-		// S3
-		// --
-		// Create a bucket policy that allows access to the bucket
-		// only from the CloudFront distribution.
-		bucketPolicy := iam.GetPolicyDocumentOutput(ctx, iam.GetPolicyDocumentOutputArgs{
-			PolicyId: pulumi.String("PolicyForCloudFrontPrivateContent"),
-			Version:  pulumi.String("2008-10-17"),
-			Statements: iam.GetPolicyDocumentStatementArray{
-				&iam.GetPolicyDocumentStatementArgs{
-					Sid: pulumi.String("1"),
-					Principals: iam.GetPolicyDocumentStatementPrincipalArray{
-						&iam.GetPolicyDocumentStatementPrincipalArgs{
-							Type: pulumi.String("AWS"),
-							Identifiers: pulumi.StringArray{
-								originAccessId.IamArn,
-							},
-						},
-					},
-					Actions: pulumi.StringArray{
-						pulumi.String("s3:GetObject"),
-					},
-					Resources: pulumi.StringArray{
-						pulumi.Sprintf("%v/*", bucket.Arn),
-					},
-				},
-			},
-		}, nil)
-
-		// Attach the bucket policy to the S3 Bucket.
-		_, err = s3.NewBucketPolicy(ctx, fmt.Sprintf("%sBucketPolicy", domain.name), &s3.BucketPolicyArgs{
-			Bucket: bucket.ID(),
-			Policy: bucketPolicy.ApplyT(func(bucketPolicy iam.GetPolicyDocumentResult) (string, error) {
-				return bucketPolicy.Json, nil
-			}).(pulumi.StringOutput),
-		})
-		if err != nil {
-			return err
-		}
-
-		// Exports will be shown as outputs to the terminal.
-		ctx.Export("bucketName", bucket.ID())
-		ctx.Export("cloudFrontDist", cloudFrontDist.ID())
+		ctx.Export("sites", siteOutputs)
 		return nil
 	})
 }
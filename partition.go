@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+// certificateRegions is the region CloudFront requires ACM certificates to
+// be issued in, by partition.
+var certificateRegions = map[string]string{
+	"aws": "us-east-1",
+}
+
+// unsupportedPartitions explains why the partitions CloudFront can not be
+// used from in the way this program needs are not supported.
+var unsupportedPartitions = map[string]string{
+	"aws-cn":     "CloudFront in China does not accept ACM certificates",
+	"aws-us-gov": "CloudFront is not available in GovCloud, deploy the website from the aws partition",
+}
+
+// lookupPartition returns the settings for the partition called name, with
+// the given base DNS domain name for its services.
+func lookupPartition(name, dnsSuffix string) (Partition, error) {
+	region, ok := certificateRegions[name]
+	if !ok {
+		reason, ok := unsupportedPartitions[name]
+		if !ok {
+			reason = "CloudFront is not available"
+		}
+		return Partition{}, fmt.Errorf("%w: %s: %s", ErrPartitionUnsupported, name, reason)
+	}
+	return Partition{
+		name:              name,
+		dnsSuffix:         dnsSuffix,
+		certificateRegion: region,
+	}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// policyDocument is the subset of an IAM policy document inspected by
+// lintPolicy.
+type policyDocument struct {
+	Statement []struct {
+		Sid       string          `json:"Sid"`
+		Effect    string          `json:"Effect"`
+		Principal json.RawMessage `json:"Principal"`
+		Action    json.RawMessage `json:"Action"`
+	} `json:"Statement"`
+}
+
+// lintPolicy inspects the JSON policy document doc and returns a finding
+// for every Allow statement that grants wildcard actions or a wildcard
+// principal, both of which are broader than the website needs.
+func lintPolicy(doc string) ([]string, error) {
+	var policy policyDocument
+	if err := json.Unmarshal([]byte(doc), &policy); err != nil {
+		return nil, fmt.Errorf("bucket policy is not valid JSON: %w", err)
+	}
+
+	findings := []string{}
+	for i, statement := range policy.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		sid := statement.Sid
+		if sid == "" {
+			sid = fmt.Sprintf("#%d", i)
+		}
+		for _, action := range jsonStrings(statement.Action) {
+			if action == "*" || strings.HasSuffix(action, ":*") {
+				findings = append(findings, fmt.Sprintf("statement %s allows wildcard action %q", sid, action))
+			}
+		}
+		// The principal is either "*" or a map of principal type to one
+		// or more identifiers.
+		principals := jsonStrings(statement.Principal)
+		var byType map[string]json.RawMessage
+		if json.Unmarshal(statement.Principal, &byType) == nil {
+			for _, ids := range byType {
+				principals = append(principals, jsonStrings(ids)...)
+			}
+		}
+		for _, principal := range principals {
+			if principal == "*" {
+				findings = append(findings, fmt.Sprintf("statement %s allows any principal", sid))
+			}
+		}
+	}
+	return findings, nil
+}
+
+// jsonStrings decodes raw as either a single string or a list of strings.
+// Anything else decodes to an empty list.
+func jsonStrings(raw json.RawMessage) []string {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return []string{one}
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		return many
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// prewarmPaths returns the URL paths of the top level pages among the
+// object keys, the root first, sorted and at most limit of them.
+func prewarmPaths(objectKeys []string, limit int) []string {
+	paths := []string{}
+	for _, key := range objectKeys {
+		if path.Ext(key) != ".html" || strings.Count(strings.TrimSuffix(key, "/index.html"), "/") > 0 {
+			continue
+		}
+		paths = append(paths, sitemapURL("", key))
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i] == "/" || (paths[j] != "/" && paths[i] < paths[j])
+	})
+	if len(paths) > limit {
+		paths = paths[:limit]
+	}
+	return paths
+}
+
+// commandPluginVersion is the version of the pulumi-command provider
+// that runs the prewarm command.
+const commandPluginVersion = "0.5.0"
+
+// prewarmCommand is a `command:local:Command` resource of the
+// pulumi-command provider, registered directly as its Go SDK is not a
+// dependency of this program.
+type prewarmCommand struct {
+	pulumi.CustomResourceState
+
+	Stdout pulumi.StringOutput `pulumi:"stdout"`
+}
+
+// newPrewarmCommand registers a command that requests every path below
+// baseURL when it is created, and is replaced so it runs again whenever
+// one of the triggers changes.
+func newPrewarmCommand(ctx *pulumi.Context, name string, baseURL pulumi.StringInput, paths []string, triggers pulumi.Array, opts ...pulumi.ResourceOption) (*prewarmCommand, error) {
+	create := baseURL.ToStringOutput().ApplyT(func(u string) string {
+		return prewarmScript(u, paths)
+	}).(pulumi.StringOutput)
+	var command prewarmCommand
+	err := ctx.RegisterResource("command:local:Command", name, pulumi.Map{
+		"create":      create,
+		"interpreter": pulumi.ToStringArray([]string{"/bin/sh", "-c"}),
+		"triggers":    triggers,
+	}, &command, append([]pulumi.ResourceOption{pulumi.Version(commandPluginVersion)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+// etagsHash returns a SHA-256 over each key and its ETag, in the order of
+// keys, which changes whenever an object does.
+func etagsHash(keys, etags []string) string {
+	h := sha256.New()
+	for i, key := range keys {
+		fmt.Fprintf(h, "%s %s\n", key, etags[i])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// prewarmScript returns a shell script that requests every path below
+// baseURL with curl, discarding the body once the edge has cached it, and
+// prints a finding for each path that was not served with a 2xx status.
+// It always exits successfully so that findings stay warnings.
+func prewarmScript(baseURL string, paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	return fmt.Sprintf(`for p in %s; do
+  status=$(curl -s -o /dev/null --max-time 10 -w '%%{http_code}' %s"$p") || status="curl exit $?"
+  case "$status" in 2??) ;; *) echo "$p: $status" ;; esac
+done
+exit 0
+`, strings.Join(quoted, " "), shellQuote(baseURL))
+}
+
+// prewarmFindings returns the findings printed by the prewarm script.
+func prewarmFindings(stdout string) []string {
+	findings := []string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			findings = append(findings, line)
+		}
+	}
+	return findings
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
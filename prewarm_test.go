@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestPrewarmScript(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.html" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("<p>page</p>"))
+	}))
+	defer server.Close()
+
+	paths := []string{"/", "/it's.html", "/missing.html"}
+	out, err := exec.Command("/bin/sh", "-c", prewarmScript(server.URL, paths)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/missing.html: 404"}
+	if got := prewarmFindings(string(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %q, want %q", got, want)
+	}
+}
+
+func TestPrewarmFindings(t *testing.T) {
+	tests := []struct {
+		stdout string
+		want   []string
+	}{
+		{"", []string{}},
+		{"\n", []string{}},
+		{"/a.html: 404\n/b.html: curl exit 28\n", []string{"/a.html: 404", "/b.html: curl exit 28"}},
+	}
+	for _, tt := range tests {
+		if got := prewarmFindings(tt.stdout); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("prewarmFindings(%q) = %q, want %q", tt.stdout, got, tt.want)
+		}
+	}
+}
+
+func TestEtagsHash(t *testing.T) {
+	keys := []string{"about.html", "index.html"}
+	base := etagsHash(keys, []string{"a", "b"})
+	if got := etagsHash(keys, []string{"a", "b"}); got != base {
+		t.Errorf("etagsHash is not stable: %s != %s", got, base)
+	}
+	if got := etagsHash(keys, []string{"a", "c"}); got == base {
+		t.Error("etagsHash did not change with an ETag")
+	}
+	if got := etagsHash([]string{"about.html", "other.html"}, []string{"a", "b"}); got == base {
+		t.Error("etagsHash did not change with a key")
+	}
+}
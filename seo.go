@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+)
+
+// sitemapURL returns the URL a page with the given object key is served
+// on below baseURL, with index documents served as their directory.
+func sitemapURL(baseURL, key string) string {
+	if path.Base(key) == "index.html" {
+		key = strings.TrimSuffix(key, "index.html")
+	}
+	return fmt.Sprintf("%s/%s", baseURL, key)
+}
+
+// sitemap returns a sitemap.xml listing every page in keys below baseURL.
+func sitemap(baseURL string, keys []string) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	for _, key := range keys {
+		buf.WriteString("  <url><loc>")
+		if err := xml.EscapeText(&buf, []byte(sitemapURL(baseURL, key))); err != nil {
+			return "", err
+		}
+		buf.WriteString("</loc></url>\n")
+	}
+	buf.WriteString("</urlset>\n")
+	return buf.String(), nil
+}
+
+// robotsTxt returns a robots.txt that allows every crawler and points them
+// at the sitemap below baseURL.
+func robotsTxt(baseURL string) string {
+	return fmt.Sprintf("User-agent: *\nAllow: /\n\nSitemap: %s/sitemap.xml\n", baseURL)
+}
+
+// redirectPage returns an HTML page that sends the browser on to target and
+// names it as the canonical URL, for keys that S3 can not redirect itself.
+func redirectPage(target string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<link rel="canonical" href="%[1]s">
+<meta http-equiv="refresh" content="0; url=%[1]s">
+</head>
+<body><a href="%[1]s">%[1]s</a></body>
+</html>
+`, html.EscapeString(target))
+}
+
+// underConstructionPage returns the placeholder page served on domain
+// while the website is first provisioned.
+func underConstructionPage(domain string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>%[1]s</title>
+</head>
+<body><h1>%[1]s</h1><p>This website is under construction, check back soon.</p></body>
+</html>
+`, html.EscapeString(domain))
+}
@@ -0,0 +1,2509 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/cloudfront"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/kinesis"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/route53"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/s3"
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/sns"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"golang.org/x/net/publicsuffix"
+)
+
+// StaticSiteArgs are the arguments of a StaticSite component, everything
+// needed to provision a single website.
+type StaticSiteArgs struct {
+	project     Project
+	environment Environment
+	site        Site
+	domain      Domain
+	tags        Tags
+	priceClass  string
+	partition   Partition
+	// provider is the AWS provider the resources are created with, or nil
+	// for the default provider.
+	provider pulumi.ProviderResource
+	// certificateProvider is the AWS provider in the certificate region of
+	// the partition, created once by the program and shared by every
+	// StaticSite, or nil for the default provider.
+	certificateProvider pulumi.ProviderResource
+
+	// config is read for the optional settings of the website.
+	config configSource
+	// objectPrefix is prepended to the resource name of every bucket
+	// object so that objects of different sites do not collide.
+	objectPrefix string
+}
+
+// StaticSite is a component resource that every resource of one website
+// is created under, so the resources of each site are grouped together
+// in the stack.
+type StaticSite struct {
+	pulumi.ResourceState
+
+	// Outputs are the outputs of the website, exported by the program.
+	Outputs pulumi.Map
+}
+
+// NewStaticSite registers the StaticSite component name and provisions the
+// website described by args under it.
+func NewStaticSite(ctx *pulumi.Context, name string, args StaticSiteArgs, opts ...pulumi.ResourceOption) (*StaticSite, error) {
+	component := &StaticSite{}
+	if err := ctx.RegisterComponentResource("stratuslabs:website:StaticSite", name, component, opts...); err != nil {
+		return nil, err
+	}
+	outputs, err := deploySite(ctx, component, args)
+	if err != nil {
+		return nil, err
+	}
+	component.Outputs = outputs
+	if err := ctx.RegisterResourceOutputs(component, outputs); err != nil {
+		return nil, err
+	}
+	return component, nil
+}
+
+// deploySite provisions the bucket, certificate, distribution and DNS
+// records for a single website under parent and returns the outputs to
+// export.
+func deploySite(ctx *pulumi.Context, parent *StaticSite, args StaticSiteArgs) (pulumi.Map, error) {
+	project := args.project
+	environment := args.environment
+	site := args.site
+	domain := args.domain
+	tags := args.tags
+	priceClass := args.priceClass
+
+	// Every resource is a child of the component. They were created
+	// without a parent before the component existed, which the alias
+	// keeps them under, rather than replacing them.
+	parentOpts := []pulumi.ResourceOption{
+		pulumi.Parent(parent),
+		pulumi.Aliases([]pulumi.Alias{{NoParent: pulumi.Bool(true)}}),
+	}
+
+	// Resources and lookups go through args.provider when one is set, and
+	// through the default AWS provider otherwise.
+	opts := append([]pulumi.ResourceOption{}, parentOpts...)
+	invokeOpts := []pulumi.InvokeOption{}
+	if args.provider != nil {
+		opts = append(opts, pulumi.Provider(args.provider))
+		invokeOpts = append(invokeOpts, pulumi.Provider(args.provider))
+	}
+	// The certificate and the CloudFront alarms must be in the certificate
+	// region, which args.certificateProvider is set to.
+	certificateOpts := append([]pulumi.ResourceOption{}, parentOpts...)
+	certificateInvokeOpts := []pulumi.InvokeOption{}
+	if args.certificateProvider != nil {
+		certificateOpts = append(certificateOpts, pulumi.Provider(args.certificateProvider))
+		certificateInvokeOpts = append(certificateInvokeOpts, pulumi.Provider(args.certificateProvider))
+	}
+
+	if err := validateDomain(domain.name); err != nil {
+		return nil, err
+	}
+
+	// hostnames are the DNS names the website is served on. hostPrefixes
+	// holds the matching prefix used in each hostname's resource names.
+	hostnames := []string{domain.name}
+	hostPrefixes := []string{""}
+	www, err := wwwAlias(domain.name, args.config)
+	if err != nil {
+		return nil, err
+	}
+	if www {
+		hostnames = append(hostnames, fmt.Sprintf("www.%s", domain.name))
+		hostPrefixes = append(hostPrefixes, "www")
+	}
+
+	// Stack Configuration
+	// -------------------
+	cfg, err := loadConfig(args.config, ctx.Stack(), args.partition, hostnames)
+	if err != nil {
+		return nil, err
+	}
+
+	// A site redirected with `externalRedirect` has no content, so its
+	// directory is not needed.
+	files := site.files
+	if files == nil && cfg.externalRedirect == "" {
+		if info, err := os.Stat(site.dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%w: %s", ErrSiteDirMissing, site.dir)
+		}
+		files = os.DirFS(site.dir)
+	}
+
+	// Every distribution alias is one of the hostnames, which must all be
+	// covered by the certificate so that TLS handshakes do not fail on
+	// some of them. The issued certificate has every hostname as its
+	// domain name or a SAN. An existing certificate can not be looked up
+	// by ARN, so its names are only checked when `certificateDomains`
+	// lists them.
+	certificateNames := hostnames
+	if cfg.certificateArn != "" || cfg.iamCertificateId != "" {
+		certificateNames = cfg.certificateDomains
+	}
+	if len(certificateNames) > 0 {
+		if uncovered := uncoveredAliases(certificateNames, hostnames); len(uncovered) > 0 {
+			return nil, fmt.Errorf("%w: %s not covered by %s", ErrAliasNotCovered, strings.Join(uncovered, ", "), strings.Join(certificateNames, ", "))
+		}
+	}
+
+	// CloudFront rejects an alias claimed by another distribution, in any
+	// account, with `CNAMEAlreadyExists` part way through the deployment.
+	// A hostname that is a CNAME to a distribution may be one, so it is
+	// warned about here. This only checks DNS, see cloudfrontCNAME, and
+	// the CNAME may be the stack's own, such as the www CNAME left from
+	// `recordType: cname`, so it is not an error.
+	if cfg.cdn != "none" {
+		for i, host := range hostnames {
+			if i > 0 && cfg.recordType == "cname" {
+				continue
+			}
+			target, warning := cloudfrontCNAME(host)
+			if warning != "" {
+				ctx.Log.Warn(fmt.Sprintf("aliases: %s", warning), nil)
+			}
+			if target != "" {
+				ctx.Log.Warn(fmt.Sprintf("aliases: %s is a CNAME to the distribution domain %s in DNS; unless that is this stack's own distribution, remove %s from its aliases first or CloudFront fails with CNAMEAlreadyExists", host, target, host), nil)
+			}
+		}
+	}
+
+	// Build tools often nest the output in a directory such as `dist/`,
+	// which `stripPrefix` removes from the object keys.
+	if cfg.stripPrefix != "" && files != nil {
+		if info, err := fs.Stat(files, cfg.stripPrefix); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("stripPrefix: %q is not a directory in the site", cfg.stripPrefix)
+		}
+		if files, err = fs.Sub(files, cfg.stripPrefix); err != nil {
+			return nil, err
+		}
+		site.dir = fmt.Sprintf("%s/%s", site.dir, cfg.stripPrefix)
+	}
+
+	// Every resource gets the same tags: the base tags plus those of
+	// `tagsFile` and then `extraTags`, which can add tags but not change
+	// the base ones. Keys listed in `requiredTags` must be among them.
+	tags = Tags{
+		tags: map[string]string{},
+	}
+	for k, v := range cfg.fileTags {
+		if _, ok := args.tags.tags[k]; ok {
+			return nil, fmt.Errorf("tagsFile: %q is set by the program and can not be overridden", k)
+		}
+		tags.tags[k] = v
+	}
+	for k, v := range cfg.extraTags {
+		if _, ok := args.tags.tags[k]; ok {
+			return nil, fmt.Errorf("extraTags: %q is set by the program and can not be overridden", k)
+		}
+		tags.tags[k] = v
+	}
+	for k, v := range args.tags.tags {
+		tags.tags[k] = v
+	}
+	missing := []string{}
+	for _, key := range cfg.requiredTags {
+		if _, ok := tags.tags[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("requiredTags: missing %s, set them with extraTags or tagsFile", strings.Join(missing, ", "))
+	}
+
+	// resourceTags returns the tags of a resource with its `Name` tag,
+	// unless `nameTagFormat` is none or `extraTags` sets one.
+	resourceTags := func(host, resource string) pulumi.StringMap {
+		named := pulumi.ToStringMap(tags.tags)
+		if _, ok := tags.tags["Name"]; !ok && cfg.nameTagFormat != "none" {
+			named["Name"] = pulumi.String(strings.NewReplacer(
+				"{project}", project.name,
+				"{environment}", environment.name,
+				"{host}", host,
+				"{resource}", resource,
+			).Replace(cfg.nameTagFormat))
+		}
+		return named
+	}
+
+	// The price class follows the environment unless `priceClassByEnv`
+	// has an entry for it, and `priceClass` overrides both.
+	if pc, ok := cfg.priceClassByEnv[environment.name]; ok {
+		priceClass = pc
+	} else if len(cfg.priceClassByEnv) > 0 {
+		ctx.Log.Warn(fmt.Sprintf("priceClassByEnv: no entry for the %s environment, using %s", environment.name, priceClass), nil)
+	}
+	if cfg.priceClass != "" {
+		priceClass = cfg.priceClass
+	}
+
+	// Allowing only countries the price class has no nearby edges for makes
+	// the website slow for everyone who can reach it.
+	if cfg.geoRestriction.Type == "whitelist" {
+		uncovered := []string{}
+		for _, country := range cfg.geoRestriction.Locations {
+			if !priceClassCovers(priceClass, country) {
+				uncovered = append(uncovered, country)
+			}
+		}
+		if len(uncovered) > 0 {
+			msg := fmt.Sprintf("geoRestriction: %s has no edge locations near %s, consider a wider price class", priceClass, strings.Join(uncovered, ", "))
+			if cfg.strictValidation {
+				return nil, errors.New(msg)
+			}
+			ctx.Log.Warn(msg, nil)
+		}
+	}
+
+	wb := WebBucket{
+		name:          cfg.bucketName,
+		indexDocument: "index.html",
+		errorDocument: "error.html",
+	}
+	// The default root object follows the environment like the price
+	// class, and is kept in sync with the index document of the bucket.
+	if root, ok := cfg.defaultRootObjectByEnv[environment.name]; ok {
+		wb.indexDocument = root
+	} else if len(cfg.defaultRootObjectByEnv) > 0 {
+		ctx.Log.Warn(fmt.Sprintf("defaultRootObjectByEnv: no entry for the %s environment, using %s", environment.name, wb.indexDocument), nil)
+	}
+	if cfg.defaultRootObject != "" {
+		wb.indexDocument = cfg.defaultRootObject
+	}
+	if cfg.noBucketErrorDocument {
+		wb.errorDocument = ""
+	}
+
+	// Website Files
+	// -------------
+	// Load the files to transfer to the websites S3 bucket, skipping any
+	// that match `excludePatterns`.
+	keys := []string{}
+	skipped := 0
+	if cfg.externalRedirect == "" {
+		keys, skipped, err = siteFiles(files, cfg.excludePatterns)
+		if err != nil {
+			return nil, err
+		}
+		if skipped > 0 {
+			ctx.Log.Info(fmt.Sprintf("Skipped %d files matching excludePatterns", skipped), nil)
+		}
+		// An empty site, or one below `minFileCount`, is not deployed over
+		// the current content.
+		source := site.dir
+		if site.files != nil {
+			source = "the embedded site"
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%w: %s has no files to upload", ErrSiteTooSmall, source)
+		}
+		if len(keys) < cfg.minFileCount {
+			return nil, fmt.Errorf("%w: %d files to upload from %s, fewer than the minFileCount of %d", ErrSiteTooSmall, len(keys), source, cfg.minFileCount)
+		}
+	} else {
+		ctx.Log.Info(fmt.Sprintf("externalRedirect: every request is redirected to %s, no content is uploaded", cfg.externalRedirect), nil)
+	}
+	if !contains(keys, wb.indexDocument) && cfg.externalRedirect == "" {
+		msg := fmt.Sprintf("defaultRootObject: %s is not one of the uploaded files, requests for / will fail", wb.indexDocument)
+		if cfg.strictValidation {
+			return nil, errors.New(msg)
+		}
+		ctx.Log.Warn(msg, nil)
+	}
+
+	// Under Construction
+	// ------------------
+	// With `underConstruction` the first deployment, before the bucket
+	// exists, serves a placeholder as the root object rather than the site,
+	// while the certificate validates and the distribution deploys. The
+	// next deployment uploads the site over it.
+	// Only a bucket S3 confirms is missing counts: any other lookup error,
+	// such as throttling or denied access, fails the deployment rather than
+	// replacing a live site with the placeholder.
+	firstDeploy := false
+	if cfg.underConstruction {
+		_, err := s3.LookupBucket(ctx, &s3.LookupBucketArgs{
+			Bucket: wb.name,
+		}, invokeOpts...)
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("underConstruction: bucket %s could not be looked up: %w", wb.name, err)
+		}
+		firstDeploy = err != nil
+	}
+	if firstDeploy {
+		ctx.Log.Info(fmt.Sprintf("underConstruction: bucket %s does not exist yet, serving a placeholder until the next deployment", wb.name), nil)
+		keys = []string{}
+	}
+
+	// Deploy Lock
+	// -----------
+	// Pulumi locks the state of a stack while it is updated, but not the
+	// content of the bucket. With `deployLock` a lock object naming the
+	// owner and the digest of the content is written before any content
+	// is uploaded, and the upload is refused while a different lock is
+	// younger than `deployLockTimeout`. Once the distributions and the
+	// content are deployed a release object with the same content
+	// releases the lock. A deployment that fails part way leaves the lock
+	// to expire. The lock is looked up here and written as a resource
+	// later, so two deployments can both pass the check: it is best
+	// effort, not a mutex.
+	//
+	// The files are hashed up front for the digest, so the lock object
+	// only changes, and is only rewritten, when the content does.
+	fileHashes := map[string]string{}
+	lockBody := ""
+	if cfg.deployLock {
+		var hashesMu sync.Mutex
+		err := uploadFiles(keys, cfg.uploadConcurrency, 0, nil, func(key string) error {
+			hash, err := fileHash(files, key, cfg.sourceHash, int64(cfg.etagPartSize)<<20)
+			if err != nil {
+				return err
+			}
+			hashesMu.Lock()
+			fileHashes[key] = hash
+			hashesMu.Unlock()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		owner := cfg.deployLockOwner
+		if owner == "" {
+			owner = fmt.Sprintf("%s/%s", ctx.Project(), ctx.Stack())
+		}
+		if lockBody, err = deployLockBody(owner, contentDigest(keys, fileHashes)); err != nil {
+			return nil, err
+		}
+		lock, err := s3.LookupBucketObject(ctx, &s3.LookupBucketObjectArgs{
+			Bucket: wb.name,
+			Key:    deployLockKey,
+		}, invokeOpts...)
+		// A bucket or lock object that does not exist yet holds no lock.
+		if err == nil {
+			released := ""
+			if release, err := s3.LookupBucketObject(ctx, &s3.LookupBucketObjectArgs{
+				Bucket: wb.name,
+				Key:    deployLockReleaseKey,
+			}, invokeOpts...); err == nil {
+				released = release.Body
+			}
+			if err := checkDeployLock(lock.Body, lock.LastModified, released, lockBody, time.Now(), cfg.deployLockTimeout); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// importMap collects the physical ID of each top level resource,
+	// keyed by its logical name, for the optional `importMap` export.
+	importMap := pulumi.StringMap{}
+
+	// dnsRecords describes every Route53 record managed for the website,
+	// in creation order, for the `dnsRecords` export.
+	dnsRecords := pulumi.Array{}
+
+	// Domain Name
+	// -----------
+	// Load the instance of the domain name that was purchased for the website.
+	// With `createZoneIfMissing` the hosted zone is created when there is
+	// none, and kept on later runs by recognising the comment it was
+	// created with.
+	zoneComment := fmt.Sprintf("Managed by Pulumi stack %s/%s", ctx.Project(), ctx.Stack())
+	// A subdomain such as `dev.example.com` is usually served from the zone
+	// of its registered domain, which is looked up when it has no zone of
+	// its own.
+	domainZone, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
+		Name: pulumi.StringRef(domain.name),
+	}, invokeOpts...)
+	if apex, _ := publicsuffix.EffectiveTLDPlusOne(domain.name); err != nil && apex != "" && apex != domain.name {
+		domainZone, err = route53.LookupZone(ctx, &route53.LookupZoneArgs{
+			Name: pulumi.StringRef(apex),
+		}, invokeOpts...)
+	}
+	if err != nil && !cfg.createZoneIfMissing {
+		return nil, fmt.Errorf("%w: %s: %v", ErrZoneNotFound, domain.name, err)
+	}
+	var zoneId pulumi.StringInput
+	var createdZone *route53.Zone
+	if err != nil || (cfg.createZoneIfMissing && domainZone.Comment == zoneComment) {
+		createdZone, err = route53.NewZone(ctx, fmt.Sprintf("%sZone", project.name), &route53.ZoneArgs{
+			Name:    pulumi.String(domain.name),
+			Comment: pulumi.String(zoneComment),
+			Tags:    pulumi.ToStringMap(tags.tags),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		zoneId = createdZone.ZoneId
+		ctx.Log.Warn(fmt.Sprintf("The hosted zone for %s is managed by this stack. DNS will not resolve until the registrar delegates the domain to the name servers in the nameServers output.", domain.name), nil)
+	} else {
+		zoneId = pulumi.String(domainZone.Id)
+	}
+
+	// S3
+	// --
+	// Create an S3 bucket and enalbe Web Hosting in order to host the website.
+	website := &s3.BucketWebsiteArgs{
+		IndexDocument: pulumi.String(wb.indexDocument),
+	}
+	if wb.errorDocument != "" {
+		website.ErrorDocument = pulumi.String(wb.errorDocument)
+	}
+	if cfg.externalRedirect != "" {
+		website = &s3.BucketWebsiteArgs{
+			RedirectAllRequestsTo: pulumi.String(cfg.externalRedirect),
+		}
+	}
+	bucketArgs := &s3.BucketArgs{
+		Website: website,
+		Tags:    resourceTags(domain.name, "bucket"),
+	}
+	if cfg.bucketNameSuffix == "random" {
+		bucketArgs.BucketPrefix = pulumi.String(wb.name + "-")
+	} else {
+		bucketArgs.Bucket = pulumi.String(wb.name)
+	}
+	// Object Lock can only be enabled when the bucket is created and
+	// requires versioning, so both are only set with `objectLock`.
+	if cfg.objectLock.Enabled {
+		bucketArgs.Versioning = &s3.BucketVersioningArgs{
+			Enabled: pulumi.Bool(true),
+		}
+		bucketArgs.ObjectLockConfiguration = &s3.BucketObjectLockConfigurationArgs{
+			ObjectLockEnabled: pulumi.String("Enabled"),
+		}
+	}
+	if cfg.forceDestroy {
+		bucketArgs.ForceDestroy = pulumi.Bool(true)
+	}
+	bucket, err := s3.NewBucket(ctx, fmt.Sprintf("%sBucket", project.name), bucketArgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	importMap[fmt.Sprintf("%sBucket", project.name)] = bucket.ID()
+
+	// Make bucket private. This blocks all access directly to the bucket.
+	// Access will be permitted for CloudFront to the bucket via a bucket policy.
+	// With `cdn: none` the bucket policy makes the objects public instead,
+	// and only ACLs stay blocked.
+	public := cfg.cdn == "none"
+	publicAccessBlock, err := s3.NewBucketPublicAccessBlock(ctx, fmt.Sprintf("%sBucketNoPublic", project.name), &s3.BucketPublicAccessBlockArgs{
+		Bucket:                bucket.ID(),
+		BlockPublicAcls:       pulumi.Bool(true),
+		BlockPublicPolicy:     pulumi.Bool(!public),
+		IgnorePublicAcls:      pulumi.Bool(true),
+		RestrictPublicBuckets: pulumi.Bool(!public),
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// With `objectLock` every new object version gets the default
+	// retention, during which it can not be overwritten or deleted.
+	if cfg.objectLock.Enabled {
+		_, err = s3.NewBucketObjectLockConfigurationV2(ctx, fmt.Sprintf("%sBucketObjectLock", project.name), &s3.BucketObjectLockConfigurationV2Args{
+			Bucket: bucket.ID(),
+			Rule: &s3.BucketObjectLockConfigurationV2RuleArgs{
+				DefaultRetention: &s3.BucketObjectLockConfigurationV2RuleDefaultRetentionArgs{
+					Mode: pulumi.String(cfg.objectLock.Mode),
+					Days: pulumi.Int(cfg.objectLock.Days),
+				},
+			},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// With `intelligentTiering` objects not requested for the configured
+	// number of days move to the archive tiers, from which they must be
+	// restored before CloudFront can serve them again.
+	if it := cfg.intelligentTiering; it.Enabled {
+		tierings := s3.BucketIntelligentTieringConfigurationTieringArray{}
+		if it.ArchiveAccessDays != 0 {
+			tierings = append(tierings, &s3.BucketIntelligentTieringConfigurationTieringArgs{
+				AccessTier: pulumi.String("ARCHIVE_ACCESS"),
+				Days:       pulumi.Int(it.ArchiveAccessDays),
+			})
+		}
+		if it.DeepArchiveAccessDays != 0 {
+			tierings = append(tierings, &s3.BucketIntelligentTieringConfigurationTieringArgs{
+				AccessTier: pulumi.String("DEEP_ARCHIVE_ACCESS"),
+				Days:       pulumi.Int(it.DeepArchiveAccessDays),
+			})
+		}
+		tieringArgs := &s3.BucketIntelligentTieringConfigurationArgs{
+			Bucket:   bucket.ID(),
+			Name:     pulumi.String("archive"),
+			Status:   pulumi.String("Enabled"),
+			Tierings: tierings,
+		}
+		if it.Prefix != "" {
+			tieringArgs.Filter = &s3.BucketIntelligentTieringConfigurationFilterArgs{
+				Prefix: pulumi.String(it.Prefix),
+			}
+		}
+		_, err = s3.NewBucketIntelligentTieringConfiguration(ctx, fmt.Sprintf("%sBucketIntelligentTiering", project.name), tieringArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+		ctx.Log.Warn("intelligentTiering: archived objects are not served until they are restored, so only archive content that is no longer linked", nil)
+	}
+
+	// With `bucketMetrics` CloudWatch publishes request metrics of the
+	// bucket, showing how often CloudFront misses and fetches from it.
+	var bucketMetric *s3.BucketMetric
+	if cfg.bucketMetrics.Enabled {
+		metricArgs := &s3.BucketMetricArgs{
+			Bucket: bucket.ID(),
+			Name:   pulumi.String("EntireBucket"),
+		}
+		if cfg.bucketMetrics.Prefix != "" {
+			metricArgs.Name = pulumi.String("OriginRequests")
+			metricArgs.Filter = &s3.BucketMetricFilterArgs{
+				Prefix: pulumi.String(cfg.bucketMetrics.Prefix),
+			}
+		}
+		bucketMetric, err = s3.NewBucketMetric(ctx, fmt.Sprintf("%sBucketMetric", project.name), metricArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Enable S3 Transfer Acceleration so uploads from distant CI runners
+	// can use the accelerate endpoint. This is billed per GB transferred.
+	if cfg.transferAcceleration {
+		_, err = s3.NewBucketAccelerateConfigurationV2(ctx, fmt.Sprintf("%sBucketAccelerate", project.name), &s3.BucketAccelerateConfigurationV2Args{
+			Bucket: bucket.ID(),
+			Status: pulumi.String("Enabled"),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The content objects are uploaded once the lock object is written.
+	// releaseLock writes the release object once deps are deployed.
+	objectOpts := opts
+	releaseLock := func(deps []pulumi.Resource) error { return nil }
+	if cfg.deployLock {
+		lockArgs := &s3.BucketObjectArgs{
+			Key:          pulumi.String(deployLockKey),
+			Bucket:       bucket.ID(),
+			Content:      pulumi.String(lockBody),
+			ContentType:  pulumi.String("application/json"),
+			CacheControl: pulumi.String("no-store"),
+			Tags:         pulumi.ToStringMap(tags.tags),
+		}
+		lock, err := s3.NewBucketObject(ctx, fmt.Sprintf("%sDeployLock", project.name), lockArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+		objectOpts = append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{lock})}, opts...)
+		releaseLock = func(deps []pulumi.Resource) error {
+			releaseArgs := *lockArgs
+			releaseArgs.Key = pulumi.String(deployLockReleaseKey)
+			_, err := s3.NewBucketObject(ctx, fmt.Sprintf("%sDeployLockRelease", project.name), &releaseArgs,
+				append([]pulumi.ResourceOption{pulumi.DependsOn(append([]pulumi.Resource{lock}, deps...))}, opts...)...)
+			return err
+		}
+	}
+
+	// The error pages are cached for `errorDocumentTtl` only, so a fix to
+	// a broken error page reaches viewers quickly.
+	errorPages := []string{}
+	if wb.errorDocument != "" {
+		errorPages = append(errorPages, wb.errorDocument)
+	}
+	for _, er := range cfg.customErrorResponses {
+		if er.Page != "" {
+			errorPages = append(errorPages, strings.TrimPrefix(er.Page, "/"))
+		}
+	}
+
+	// With `cleanUrlKeys` pages are uploaded as directory indexes so they
+	// are served on clean URLs without a CloudFront Function.
+	// The root object keeps its key, as it is requested by name.
+	objectKeys, err := cleanUrlKeys(keys, cfg.cleanUrlKeys.Enabled, append([]string{wb.indexDocument}, errorPages...))
+	if err != nil {
+		return nil, fmt.Errorf("cleanUrlKeys: %w", err)
+	}
+	// With `mountPath` every object is uploaded below the mount, so that
+	// `/docs/about.html` is served from the key `docs/about.html`.
+	mountPrefix := ""
+	if cfg.mountPath != "" {
+		mountPrefix = strings.TrimPrefix(cfg.mountPath, "/") + "/"
+		for key, objectKey := range objectKeys {
+			objectKeys[key] = mountPrefix + objectKey
+		}
+	}
+
+	// Upload the website files to the bucket. Files are hashed and
+	// registered `uploadConcurrency` at a time. The ETags of the uploaded
+	// objects are collected by key for `prewarm`, which runs again when
+	// they change.
+	var uploadedMu sync.Mutex
+	uploadedEtags := map[string]pulumi.StringOutput{}
+	contentObjects := []pulumi.Resource{}
+	addObject := func(object *s3.BucketObject) {
+		uploadedMu.Lock()
+		contentObjects = append(contentObjects, object)
+		uploadedMu.Unlock()
+	}
+	// With `uploadProgress` a count of the files registered so far is
+	// logged every that many files.
+	progress := func(done int) {
+		ctx.Log.Info(fmt.Sprintf("uploads: registered %d of %d files", done, len(keys)), nil)
+	}
+	err = uploadFiles(keys, cfg.uploadConcurrency, cfg.uploadProgress, progress, func(key string) error {
+		hash, ok := fileHashes[key]
+		if !ok {
+			var err error
+			if hash, err = fileHash(files, key, cfg.sourceHash, int64(cfg.etagPartSize)<<20); err != nil {
+				return err
+			}
+		}
+		objectArgs := &s3.BucketObjectArgs{
+			Key:          pulumi.String(objectKeys[key]),
+			Bucket:       bucket.ID(),
+			SourceHash:   pulumi.String(hash),
+			ContentType:  pulumi.String(contentType(key)),
+			StorageClass: pulumi.String(storageClass(key, cfg.storageClasses)),
+			Tags:         pulumi.ToStringMap(tags.tags),
+		}
+		if value := cacheControl(key, cfg.cacheControl); value != "" {
+			objectArgs.CacheControl = pulumi.String(value)
+		}
+		if contains(errorPages, key) {
+			objectArgs.CacheControl = pulumi.String(fmt.Sprintf("max-age=%d", cfg.errorDocumentTtl))
+		}
+		if language := contentLanguage(key, cfg.contentLanguages); language != "" {
+			objectArgs.ContentLanguage = pulumi.String(language)
+		}
+		// Text assets are compressed when `gzipAssets` is enabled. The key
+		// and content type stay the same, only the encoding changes.
+		info, err := fs.Stat(files, key)
+		if err != nil {
+			return err
+		}
+		switch {
+		case gzipEligible(key, info.Size(), cfg.gzipAssets):
+			body, err := gzipFile(files, key)
+			if err != nil {
+				return err
+			}
+			objectArgs.ContentBase64 = pulumi.String(body)
+			objectArgs.ContentEncoding = pulumi.String("gzip")
+		case site.files == nil:
+			objectArgs.Source = pulumi.NewFileAsset(fmt.Sprintf("%s/%s", site.dir, key))
+		default:
+			// Embedded files have no path on disk for a file asset.
+			body, err := readFile(files, key)
+			if err != nil {
+				return err
+			}
+			objectArgs.ContentBase64 = pulumi.String(body)
+		}
+		// With `preserveModTime` the mod time of the source file is kept
+		// in the object metadata. Embedded files have none.
+		if cfg.preserveModTime && !info.ModTime().IsZero() {
+			objectArgs.Metadata = pulumi.StringMap{
+				"mtime": pulumi.String(info.ModTime().UTC().Format(time.RFC3339)),
+			}
+		}
+		object, err := s3.NewBucketObject(ctx, args.objectPrefix+objectKeys[key], objectArgs, objectOpts...)
+		if err != nil {
+			return err
+		}
+		addObject(object)
+		if cfg.prewarm.Enabled {
+			uploadedMu.Lock()
+			uploadedEtags[objectKeys[key]] = object.Etag
+			uploadedMu.Unlock()
+		}
+		// A copy of each directory index is kept under the key of its
+		// directory, so `/blog/` is served without a function.
+		if dirKey := directoryKey(objectKeys[key]); cfg.directoryKeys && dirKey != "" {
+			dirArgs := *objectArgs
+			dirArgs.Key = pulumi.String(dirKey)
+			dirObject, err := s3.NewBucketObject(ctx, args.objectPrefix+dirKey, &dirArgs, objectOpts...)
+			if err != nil {
+				return err
+			}
+			addObject(dirObject)
+		}
+		if objectKeys[key] == key || cfg.cleanUrlKeys.Original != "redirect" {
+			return nil
+		}
+		// The original key is kept as a page sending browsers on to the
+		// clean URL, as the bucket can not redirect itself.
+		redirect, err := s3.NewBucketObject(ctx, args.objectPrefix+mountPrefix+key, &s3.BucketObjectArgs{
+			Key:          pulumi.String(mountPrefix + key),
+			Bucket:       bucket.ID(),
+			Content:      pulumi.String(redirectPage("/" + strings.TrimSuffix(objectKeys[key], "index.html"))),
+			ContentType:  pulumi.String(contentType(key)),
+			StorageClass: pulumi.String(storageClass(key, cfg.storageClasses)),
+			Tags:         pulumi.ToStringMap(tags.tags),
+		}, objectOpts...)
+		if err != nil {
+			return err
+		}
+		addObject(redirect)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The placeholder is never cached, so the site replaces it as soon as
+	// it is uploaded under the same name.
+	if firstDeploy {
+		placeholder, err := s3.NewBucketObject(ctx, args.objectPrefix+wb.indexDocument, &s3.BucketObjectArgs{
+			Key:          pulumi.String(wb.indexDocument),
+			Bucket:       bucket.ID(),
+			Content:      pulumi.String(underConstructionPage(domain.name)),
+			ContentType:  pulumi.String(contentType(wb.indexDocument)),
+			CacheControl: pulumi.String("no-cache"),
+			Tags:         pulumi.ToStringMap(tags.tags),
+		}, objectOpts...)
+		if err != nil {
+			return nil, err
+		}
+		addObject(placeholder)
+	}
+
+	// The root of a mounted website sends visitors on to the mount, as
+	// the root object is not uploaded there.
+	if cfg.mountPath != "" && !firstDeploy {
+		rootRedirect, err := s3.NewBucketObject(ctx, args.objectPrefix+wb.indexDocument, &s3.BucketObjectArgs{
+			Key:         pulumi.String(wb.indexDocument),
+			Bucket:      bucket.ID(),
+			Content:     pulumi.String(redirectPage(cfg.mountPath + "/")),
+			ContentType: pulumi.String(contentType(wb.indexDocument)),
+			Tags:        pulumi.ToStringMap(tags.tags),
+		}, objectOpts...)
+		if err != nil {
+			return nil, err
+		}
+		addObject(rootRedirect)
+	}
+
+	// With `generateSeoFiles` a sitemap.xml listing the HTML pages, apart
+	// from the error pages and private content, and a robots.txt pointing
+	// to it are uploaded, unless the site provides its own.
+	if cfg.generateSeoFiles {
+		pages := []string{}
+		for _, source := range keys {
+			key := objectKeys[source]
+			if path.Ext(key) != ".html" || contains(errorPages, key) {
+				continue
+			}
+			private := false
+			if cfg.privateContent.Enabled {
+				for _, pattern := range cfg.privateContent.PathPatterns {
+					private = private || pathPatternMatch(pattern, key)
+				}
+			}
+			if !private {
+				pages = append(pages, key)
+			}
+		}
+		body, err := sitemap(cfg.canonicalUrl, pages)
+		if err != nil {
+			return nil, err
+		}
+		seoFiles := map[string]string{
+			"sitemap.xml": body,
+			"robots.txt":  robotsTxt(cfg.canonicalUrl),
+		}
+		for _, key := range []string{"sitemap.xml", "robots.txt"} {
+			if contains(keys, key) {
+				continue
+			}
+			seoFile, err := s3.NewBucketObject(ctx, args.objectPrefix+key, &s3.BucketObjectArgs{
+				Key:          pulumi.String(key),
+				Bucket:       bucket.ID(),
+				Content:      pulumi.String(seoFiles[key]),
+				ContentType:  pulumi.String(contentType(key)),
+				StorageClass: pulumi.String(storageClass(key, cfg.storageClasses)),
+				Tags:         pulumi.ToStringMap(tags.tags),
+			}, objectOpts...)
+			if err != nil {
+				return nil, err
+			}
+			addObject(seoFile)
+		}
+	}
+
+	// S3 Website
+	// ----------
+	// With `cdn: none` there is no certificate or distribution: the bucket
+	// website endpoint serves the hostnames directly over plain HTTP. The
+	// endpoint routes requests by their Host header to the bucket of the
+	// same name, so the other hostname gets an empty bucket of its own
+	// that redirects every request to the website bucket.
+	if cfg.cdn == "none" {
+		websiteBuckets := map[string]*s3.Bucket{}
+		for i, host := range hostnames {
+			if host == cfg.bucketName {
+				websiteBuckets[host] = bucket
+				continue
+			}
+			redirectBucket, err := s3.NewBucket(ctx, fmt.Sprintf("%s%sRedirectBucket", hostPrefixes[i], project.name), &s3.BucketArgs{
+				Bucket: pulumi.String(host),
+				Website: &s3.BucketWebsiteArgs{
+					RedirectAllRequestsTo: pulumi.String("http://" + cfg.bucketName),
+				},
+				ForceDestroy: pulumi.Bool(cfg.forceDestroy),
+				Tags:         resourceTags(host, "bucket"),
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			importMap[fmt.Sprintf("%s%sRedirectBucket", hostPrefixes[i], project.name)] = redirectBucket.ID()
+			websiteBuckets[host] = redirectBucket
+		}
+
+		// Anyone can read the objects, as the website endpoint serves
+		// anonymous requests only. The policy is intentionally public and
+		// so is not linted. The objects of `deployLock` are denied to
+		// anonymous requests, as they name the owner.
+		publicPolicy := pulumi.Sprintf(`{"Version":"2012-10-17","Statement":[{"Sid":"PublicReadForWebsite","Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"%s/*"}]}`, bucket.Arn)
+		if cfg.deployLock {
+			publicPolicy = pulumi.Sprintf(`{"Version":"2012-10-17","Statement":[{"Sid":"PublicReadForWebsite","Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"%s/*"},{"Sid":"DenyDeployLock","Effect":"Deny","Principal":"*","Action":"s3:GetObject","Resource":"%s/%s*","Condition":{"StringEquals":{"aws:PrincipalType":"Anonymous"}}}]}`, bucket.Arn, bucket.Arn, deployLockPrefix)
+		}
+		policy, err := s3.NewBucketPolicy(ctx, fmt.Sprintf("%sBucketPolicy", domain.name), &s3.BucketPolicyArgs{
+			Bucket: bucket.ID(),
+			Policy: publicPolicy,
+		}, append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{publicAccessBlock})}, opts...)...)
+		if err != nil {
+			return nil, err
+		}
+		importMap[fmt.Sprintf("%sBucketPolicy", domain.name)] = policy.ID()
+		if err := releaseLock(append([]pulumi.Resource{policy}, contentObjects...)); err != nil {
+			return nil, err
+		}
+
+		// Website endpoints are IPv4 only, so each hostname gets an A
+		// alias record to the endpoint of its bucket.
+		for i, host := range hostnames {
+			name := fmt.Sprintf("%s%sA", hostPrefixes[i], project.name)
+			recordArgs := &route53.RecordArgs{
+				ZoneId: zoneId,
+				Name:   pulumi.String(host),
+				Type:   pulumi.String("A"),
+				Aliases: route53.RecordAliasArray{
+					&route53.RecordAliasArgs{
+						Name:                 websiteBuckets[host].WebsiteDomain,
+						ZoneId:               websiteBuckets[host].HostedZoneId,
+						EvaluateTargetHealth: pulumi.Bool(cfg.evaluateTargetHealth),
+					},
+				},
+			}
+			setRoutingPolicy(recordArgs, cfg.routingPolicy)
+			aliasRecord, err := route53.NewRecord(ctx, name, recordArgs, opts...)
+			if err != nil {
+				return nil, err
+			}
+			importMap[name] = aliasRecord.ID()
+			dnsRecords = append(dnsRecords, pulumi.Map{
+				"name":        aliasRecord.Name,
+				"type":        aliasRecord.Type,
+				"aliasTarget": websiteBuckets[host].WebsiteDomain,
+			})
+		}
+
+		summary := []string{
+			fmt.Sprintf("Hostnames: %s", strings.Join(hostnames, ", ")),
+			fmt.Sprintf("Files: %d uploaded, %d excluded", len(keys), skipped),
+			fmt.Sprintf("Bucket: %s", wb.name),
+			"CDN: none, served over HTTP by the S3 website endpoint",
+		}
+		outputs := pulumi.Map{}
+		outputs["planSummary"] = pulumi.String(strings.Join(summary, "\n"))
+		outputs["bucketName"] = bucket.ID()
+		outputs["websiteEndpoint"] = bucket.WebsiteEndpoint
+		monitoring := pulumi.Map{
+			"distributions": pulumi.Array{},
+			"bucket":        bucketMonitoring(bucket),
+		}
+		if bucketMetric != nil {
+			outputs["bucketMetricName"] = bucketMetric.Name
+			monitoring["bucketMetric"] = bucketMetricMonitoring(bucket, bucketMetric)
+		}
+		outputs["monitoring"] = monitoring
+		outputs["dnsRecords"] = dnsRecords
+		outputs["canonicalUrl"] = pulumi.String(cfg.canonicalUrl)
+		outputs["zoneId"] = zoneId
+		if createdZone != nil {
+			outputs["nameServers"] = createdZone.NameServers
+		}
+		if cfg.emitImportMap {
+			outputs["importMap"] = importMap.ToStringMapOutput().ApplyT(func(ids map[string]string) (string, error) {
+				b, err := json.MarshalIndent(ids, "", "  ")
+				return string(b), err
+			}).(pulumi.StringOutput)
+		}
+		if err := markSecretOutputs(ctx, cfg, outputs); err != nil {
+			return nil, err
+		}
+		return outputs, nil
+	}
+
+	// Certificate Manager
+	// -------------------
+	// Create a Public Certificate that will be used in the CloudFront distribution
+	// to enable TLS connections to the website. When `certificateArn` points at
+	// an existing, usually shared wildcard, certificate it is used instead and
+	// no certificate or validation records are created.
+	//
+	// With `reuseExistingCert` the most recent certificate ACM issued for
+	// the domain is used in the same way, if it covers every hostname, so
+	// repeated greenfield deployments do not issue duplicates. The stack's
+	// own certificate carries its tags and stays managed by it.
+	existingCertificateArn := cfg.certificateArn
+	if cfg.reuseExistingCert {
+		existing, err := acm.LookupCertificate(ctx, &acm.LookupCertificateArgs{
+			Domain:     domain.name,
+			Statuses:   []string{"ISSUED"},
+			Types:      []string{"AMAZON_ISSUED"},
+			MostRecent: pulumi.BoolRef(true),
+		}, certificateInvokeOpts...)
+		switch {
+		case err != nil:
+			ctx.Log.Info(fmt.Sprintf("reuseExistingCert: no issued certificate found for %s, issuing one", domain.name), nil)
+		case ownCertificate(existing.Tags, tags.tags):
+			// Issued by this stack, which keeps managing it.
+		default:
+			names, err := certificateDNSNames(existing.Certificate)
+			if err != nil {
+				return nil, fmt.Errorf("reuseExistingCert: %s: %w", existing.Arn, err)
+			}
+			if uncovered := uncoveredAliases(names, hostnames); len(uncovered) > 0 {
+				ctx.Log.Info(fmt.Sprintf("reuseExistingCert: %s does not cover %s, issuing a certificate", existing.Arn, strings.Join(uncovered, ", ")), nil)
+			} else {
+				ctx.Log.Info(fmt.Sprintf("reuseExistingCert: using %s", existing.Arn), nil)
+				existingCertificateArn = existing.Arn
+			}
+		}
+	}
+	var certificateArn pulumi.StringInput
+	var certificateStatus pulumi.StringOutput
+	if cfg.iamCertificateId != "" {
+		// The distributions serve the IAM server certificate, which is
+		// neither issued nor renewed by ACM.
+		ctx.Log.Warn(fmt.Sprintf("iamCertificateId: %s is not renewed automatically, replace it in IAM before it expires", cfg.iamCertificateId), nil)
+	} else if existingCertificateArn != "" {
+		certificateArn = pulumi.String(existingCertificateArn)
+		// ACM only renews the certificate while its validation records
+		// resolve, and they are not managed by this stack.
+		ctx.Log.Warn(fmt.Sprintf("certificate: the DNS validation records of %s are managed outside this stack, keep them in place or the certificate will not renew", existingCertificateArn), nil)
+	} else {
+		certificateArgs := &acm.CertificateArgs{
+			DomainName:              pulumi.String(domain.name),
+			ValidationMethod:        pulumi.String("DNS"),
+			SubjectAlternativeNames: pulumi.ToStringArray(hostnames[1:]),
+			Tags:                    resourceTags(domain.name, "certificate"),
+		}
+		// Options are only sent when configured, as changing them replaces
+		// the certificate.
+		if cfg.certificateTransparency != "" {
+			certificateArgs.Options = &acm.CertificateOptionsArgs{
+				CertificateTransparencyLoggingPreference: pulumi.String(cfg.certificateTransparency),
+			}
+		}
+		certificate, err := acm.NewCertificate(ctx, fmt.Sprintf("%sCert", project.name), certificateArgs, certificateOpts...)
+		if err != nil {
+			return nil, err
+		}
+		importMap[fmt.Sprintf("%sCert", project.name)] = certificate.Arn
+
+		// Add CNAME records to Route53. This is used to validate that we own
+		// the domain we are requesting certificates for. Records created by
+		// hand before the first run are taken over, as long as they already
+		// point where ACM expects.
+		for i := range hostnames {
+			name := fmt.Sprintf("%sCname%d", project.name, i)
+			option := certificate.DomainValidationOptions.Index(pulumi.Int(i))
+			recordName := option.ResourceRecordName().Elem()
+			recordValue := pulumi.All(recordName, option.ResourceRecordValue().Elem()).ApplyT(func(args []interface{}) (string, error) {
+				value := args[1].(string)
+				warning, err := checkValidationRecord(args[0].(string), value)
+				if warning != "" {
+					ctx.Log.Warn(fmt.Sprintf("certificate: %s", warning), nil)
+				}
+				return value, err
+			}).(pulumi.StringOutput)
+			cname, err := route53.NewRecord(ctx, name, &route53.RecordArgs{
+				ZoneId:         zoneId,
+				Name:           recordName,
+				Type:           pulumi.String("CNAME"),
+				Ttl:            pulumi.Int(60),
+				Records:        pulumi.StringArray{recordValue},
+				AllowOverwrite: pulumi.Bool(true),
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			importMap[name] = cname.ID()
+			dnsRecords = append(dnsRecords, pulumi.Map{
+				"name":  cname.Name,
+				"type":  cname.Type,
+				"value": cname.Records.Index(pulumi.Int(0)),
+			})
+		}
+		certificateArn = certificate.Arn
+
+		// ACM renews the certificate only while the validation records
+		// resolve, so check that every validation record is one created
+		// above and falls inside the zone it is created in.
+		zoneName := domain.name
+		if createdZone == nil {
+			zoneName = strings.TrimSuffix(domainZone.Name, ".")
+		}
+		certificateStatus = pulumi.All(certificate.Status, certificate.DomainValidationOptions).ApplyT(func(args []interface{}) (string, error) {
+			status := args[0].(string)
+			for i, option := range args[1].([]acm.CertificateDomainValidationOption) {
+				if option.ResourceRecordName == nil {
+					continue
+				}
+				var finding string
+				recordName := strings.TrimSuffix(*option.ResourceRecordName, ".")
+				if i >= len(hostnames) {
+					finding = fmt.Sprintf("no validation record is managed for %s", recordName)
+				} else if !strings.HasSuffix(recordName, "."+zoneName) {
+					finding = fmt.Sprintf("validation record %s is outside the zone %s", recordName, zoneName)
+				}
+				if finding == "" {
+					continue
+				}
+				if cfg.strictValidation {
+					return "", fmt.Errorf("certificate: %s, the certificate will not renew", finding)
+				}
+				ctx.Log.Warn(fmt.Sprintf("certificate: %s, the certificate will not renew", finding), nil)
+			}
+			return status, nil
+		}).(pulumi.StringOutput)
+	}
+
+	// CloudFront
+	// ----------
+	// Create a CloudFront Origin Access Identity.
+	// This is used to attach the CloudFront Distribution to an S3 bucket.
+	originAccessId, err := cloudfront.NewOriginAccessIdentity(ctx, fmt.Sprintf("%sOriginAccessId", project.name), &cloudfront.OriginAccessIdentityArgs{
+		Comment: pulumi.String(project.name),
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	importMap[fmt.Sprintf("%sOriginAccessId", project.name)] = originAccessId.ID()
+
+	// The default cache behavior ignores query strings. When
+	// `cacheQueryStrings` is set, or `cors` is enabled, a cache policy is
+	// created so that query strings or CORS headers are part of the cache key.
+	defaultCacheBehavior := &cloudfront.DistributionDefaultCacheBehaviorArgs{
+		AllowedMethods: pulumi.StringArray{
+			pulumi.String("GET"),
+			pulumi.String("HEAD"),
+		},
+		CachedMethods: pulumi.StringArray{
+			pulumi.String("GET"),
+			pulumi.String("HEAD"),
+		},
+		TargetOriginId:       bucket.ID(),
+		ViewerProtocolPolicy: pulumi.String("redirect-to-https"),
+		// Static files are never streamed in the Microsoft Smooth
+		// Streaming format.
+		SmoothStreaming: pulumi.Bool(false),
+		Compress:        pulumi.Bool(cfg.compress),
+	}
+
+	// CloudFront only compresses objects between 1KB and 10MB at the edge,
+	// so a site whose text assets are mostly larger gains little from
+	// `compress` and should compress them at upload instead.
+	if cfg.compress {
+		var total, large int64
+		for _, key := range keys {
+			info, err := fs.Stat(files, key)
+			if err != nil {
+				return nil, err
+			}
+			if !contains(defaultGzipExtensions, strings.ToLower(path.Ext(key))) || gzipEligible(key, info.Size(), cfg.gzipAssets) {
+				continue
+			}
+			total += info.Size()
+			if info.Size() > 10*1024*1024 {
+				large += info.Size()
+			}
+		}
+		if large*2 > total {
+			ctx.Log.Warn(fmt.Sprintf("compress: %d of %d bytes of text assets are in files above the 10MB CloudFront compresses, enable gzipAssets to compress them at upload", large, total), nil)
+		}
+	}
+
+	// Real-Time Logs
+	// --------------
+	// When `realtimeLogs` is enabled, CloudFront sends a sample of its
+	// requests to a Kinesis data stream as they happen. The stream is
+	// created unless the ARN of an existing one is supplied.
+	var realtimeLogStreamArn pulumi.StringOutput
+	if cfg.realtimeLogs.Enabled {
+		streamArn := pulumi.String(cfg.realtimeLogs.StreamArn).ToStringOutput()
+		if cfg.realtimeLogs.StreamArn == "" {
+			stream, err := kinesis.NewStream(ctx, fmt.Sprintf("%sRealtimeLogStream", project.name), &kinesis.StreamArgs{
+				ShardCount:      pulumi.Int(1),
+				RetentionPeriod: pulumi.Int(24),
+				Tags:            pulumi.ToStringMap(tags.tags),
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			streamArn = stream.Arn
+		}
+		realtimeLogStreamArn = streamArn
+
+		// CloudFront assumes this role to write the log records to the stream.
+		realtimeLogRole, err := iam.NewRole(ctx, fmt.Sprintf("%sRealtimeLogRole", project.name), &iam.RoleArgs{
+			AssumeRolePolicy: pulumi.String(fmt.Sprintf(`{
+"Version": "2012-10-17",
+"Statement": [{
+	"Effect": "Allow",
+	"Principal": {"Service": "cloudfront.%s"},
+	"Action": "sts:AssumeRole"
+}]
+}`, args.partition.dnsSuffix)),
+			Tags: pulumi.ToStringMap(tags.tags),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		_, err = iam.NewRolePolicy(ctx, fmt.Sprintf("%sRealtimeLogRolePolicy", project.name), &iam.RolePolicyArgs{
+			Role: realtimeLogRole.ID(),
+			Policy: pulumi.Sprintf(`{
+"Version": "2012-10-17",
+"Statement": [{
+	"Effect": "Allow",
+	"Action": [
+		"kinesis:DescribeStreamSummary",
+		"kinesis:DescribeStream",
+		"kinesis:PutRecord",
+		"kinesis:PutRecords"
+	],
+	"Resource": "%s"
+}]
+}`, streamArn),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		realtimeLogConfig, err := cloudfront.NewRealtimeLogConfig(ctx, fmt.Sprintf("%sRealtimeLogConfig", project.name), &cloudfront.RealtimeLogConfigArgs{
+			Name:         pulumi.String(fmt.Sprintf("%s-%s", project.name, environment.name)),
+			SamplingRate: pulumi.Int(cfg.realtimeLogs.SamplingRate),
+			Fields:       pulumi.ToStringArray(cfg.realtimeLogs.Fields),
+			Endpoint: &cloudfront.RealtimeLogConfigEndpointArgs{
+				StreamType: pulumi.String("Kinesis"),
+				KinesisStreamConfig: &cloudfront.RealtimeLogConfigEndpointKinesisStreamConfigArgs{
+					RoleArn:   realtimeLogRole.Arn,
+					StreamArn: streamArn,
+				},
+			},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultCacheBehavior.RealtimeLogConfigArn = realtimeLogConfig.Arn
+	}
+
+	// Cross-Origin Resource Sharing
+	// -----------------------------
+	// When `cors` is enabled S3 answers CORS preflight requests for the
+	// configured origins. OPTIONS is cached by CloudFront with the CORS
+	// request headers in the cache key, so each origin gets its own
+	// preflight response without a trip to the bucket.
+	if cfg.cors.Enabled {
+		_, err = s3.NewBucketCorsConfigurationV2(ctx, fmt.Sprintf("%sBucketCors", project.name), &s3.BucketCorsConfigurationV2Args{
+			Bucket: bucket.ID(),
+			CorsRules: s3.BucketCorsConfigurationV2CorsRuleArray{
+				&s3.BucketCorsConfigurationV2CorsRuleArgs{
+					AllowedHeaders: pulumi.StringArray{pulumi.String("*")},
+					AllowedMethods: pulumi.StringArray{pulumi.String("GET"), pulumi.String("HEAD")},
+					AllowedOrigins: pulumi.ToStringArray(cfg.cors.AllowedOrigins),
+					MaxAgeSeconds:  pulumi.Int(cfg.cors.PreflightTtl),
+				},
+			},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultCacheBehavior.AllowedMethods = append(defaultCacheBehavior.AllowedMethods.(pulumi.StringArray), pulumi.String("OPTIONS"))
+		defaultCacheBehavior.CachedMethods = append(defaultCacheBehavior.CachedMethods.(pulumi.StringArray), pulumi.String("OPTIONS"))
+	}
+
+	if cfg.cachePolicyId != "" {
+		defaultCacheBehavior.CachePolicyId = pulumi.String(cfg.cachePolicyId)
+	} else if cfg.cacheQueryStrings == "none" && !cfg.cors.Enabled && !cfg.cacheAcceptLanguage {
+		defaultCacheBehavior.ForwardedValues = &cloudfront.DistributionDefaultCacheBehaviorForwardedValuesArgs{
+			QueryString: pulumi.Bool(false),
+			Cookies: &cloudfront.DistributionDefaultCacheBehaviorForwardedValuesCookiesArgs{
+				Forward: pulumi.String("none"),
+			},
+		}
+		defaultCacheBehavior.MinTtl = pulumi.Int(0)
+		defaultCacheBehavior.DefaultTtl = pulumi.Int(3600)
+		defaultCacheBehavior.MaxTtl = pulumi.Int(86400)
+	} else {
+		queryStringsConfig := &cloudfront.CachePolicyParametersInCacheKeyAndForwardedToOriginQueryStringsConfigArgs{
+			QueryStringBehavior: pulumi.String(cfg.cacheQueryStrings),
+		}
+		if cfg.cacheQueryStrings == "whitelist" {
+			queryStringsConfig.QueryStrings = &cloudfront.CachePolicyParametersInCacheKeyAndForwardedToOriginQueryStringsConfigQueryStringsArgs{
+				Items: pulumi.ToStringArray(cfg.cacheQueryStringWhitelist),
+			}
+		}
+		headersConfig := &cloudfront.CachePolicyParametersInCacheKeyAndForwardedToOriginHeadersConfigArgs{
+			HeaderBehavior: pulumi.String("none"),
+		}
+		headers := pulumi.StringArray{}
+		if cfg.cors.Enabled {
+			headers = append(headers,
+				pulumi.String("Origin"),
+				pulumi.String("Access-Control-Request-Method"),
+				pulumi.String("Access-Control-Request-Headers"),
+			)
+		}
+		if cfg.cacheAcceptLanguage {
+			headers = append(headers, pulumi.String("Accept-Language"))
+		}
+		if len(headers) > 0 {
+			headersConfig.HeaderBehavior = pulumi.String("whitelist")
+			headersConfig.Headers = &cloudfront.CachePolicyParametersInCacheKeyAndForwardedToOriginHeadersConfigHeadersArgs{
+				Items: headers,
+			}
+		}
+		cachePolicy, err := cloudfront.NewCachePolicy(ctx, fmt.Sprintf("%sCachePolicy", project.name), &cloudfront.CachePolicyArgs{
+			Comment:    pulumi.String(project.name),
+			MinTtl:     pulumi.Int(0),
+			DefaultTtl: pulumi.Int(3600),
+			MaxTtl:     pulumi.Int(86400),
+			ParametersInCacheKeyAndForwardedToOrigin: &cloudfront.CachePolicyParametersInCacheKeyAndForwardedToOriginArgs{
+				CookiesConfig: &cloudfront.CachePolicyParametersInCacheKeyAndForwardedToOriginCookiesConfigArgs{
+					CookieBehavior: pulumi.String("none"),
+				},
+				HeadersConfig:      headersConfig,
+				QueryStringsConfig: queryStringsConfig,
+			},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultCacheBehavior.CachePolicyId = cachePolicy.ID()
+	}
+	if cfg.originRequestPolicyId != "" {
+		defaultCacheBehavior.OriginRequestPolicyId = pulumi.String(cfg.originRequestPolicyId)
+	}
+	if cfg.responseHeadersPolicyId != "" {
+		defaultCacheBehavior.ResponseHeadersPolicyId = pulumi.String(cfg.responseHeadersPolicyId)
+	}
+
+	// With `contentSecurityPolicy` a response headers policy sends the
+	// enforced policy, the report-only policy or both, replacing any
+	// Content-Security-Policy headers set by the origin.
+	//
+	// The `customResponseHeaders` are sent through the same policy.
+	if csp := cfg.contentSecurityPolicy; csp.Enabled() || len(cfg.customResponseHeaders) > 0 {
+		policyArgs := &cloudfront.ResponseHeadersPolicyArgs{
+			Comment: pulumi.String(project.name),
+		}
+		if csp.Policy != "" {
+			policyArgs.SecurityHeadersConfig = &cloudfront.ResponseHeadersPolicySecurityHeadersConfigArgs{
+				ContentSecurityPolicy: &cloudfront.ResponseHeadersPolicySecurityHeadersConfigContentSecurityPolicyArgs{
+					ContentSecurityPolicy: pulumi.String(csp.header(csp.Policy)),
+					Override:              pulumi.Bool(true),
+				},
+			}
+		}
+		// CloudFront has no security header for the report-only policy, so
+		// it is sent as a custom header.
+		customHeaders := cloudfront.ResponseHeadersPolicyCustomHeadersConfigItemArray{}
+		if csp.ReportOnly != "" {
+			customHeaders = append(customHeaders, &cloudfront.ResponseHeadersPolicyCustomHeadersConfigItemArgs{
+				Header:   pulumi.String("Content-Security-Policy-Report-Only"),
+				Override: pulumi.Bool(true),
+				Value:    pulumi.String(csp.header(csp.ReportOnly)),
+			})
+		}
+		names := make([]string, 0, len(cfg.customResponseHeaders))
+		for name := range cfg.customResponseHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			customHeaders = append(customHeaders, &cloudfront.ResponseHeadersPolicyCustomHeadersConfigItemArgs{
+				Header:   pulumi.String(name),
+				Override: pulumi.Bool(true),
+				Value:    pulumi.String(cfg.customResponseHeaders[name]),
+			})
+		}
+		if len(customHeaders) > 0 {
+			policyArgs.CustomHeadersConfig = &cloudfront.ResponseHeadersPolicyCustomHeadersConfigArgs{
+				Items: customHeaders,
+			}
+		}
+		responseHeadersPolicy, err := cloudfront.NewResponseHeadersPolicy(ctx, fmt.Sprintf("%sResponseHeadersPolicy", project.name), policyArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultCacheBehavior.ResponseHeadersPolicyId = responseHeadersPolicy.ID()
+	}
+
+	// Canonical URLs
+	// --------------
+	// The canonicalize CloudFront Function redirects every request to a
+	// single canonical URL, avoiding duplicate content for search engines.
+	if cfg.canonicalize.Enabled() {
+		code, err := renderFunction("canonicalize.js", cfg.canonicalize)
+		if err != nil {
+			return nil, err
+		}
+		canonicalizeFunction, err := cloudfront.NewFunction(ctx, fmt.Sprintf("%sCanonicalize", project.name), &cloudfront.FunctionArgs{
+			Name:    pulumi.String(fmt.Sprintf("%s-%s-canonicalize", project.name, environment.name)),
+			Runtime: pulumi.String("cloudfront-js-1.0"),
+			Comment: pulumi.String("Redirects requests to their canonical URL"),
+			Code:    pulumi.String(code),
+			Publish: pulumi.Bool(true),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultCacheBehavior.FunctionAssociations = cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArray{
+			&cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArgs{
+				EventType:   pulumi.String("viewer-request"),
+				FunctionArn: canonicalizeFunction.Arn,
+			},
+		}
+	}
+
+	// Basic Auth
+	// ----------
+	// The basic-auth CloudFront Function keeps a staging site private by
+	// asking for credentials on every path served from the bucket. The
+	// code holds the credentials, so it is stored as a secret.
+	orderedFunctionAssociations := cloudfront.DistributionOrderedCacheBehaviorFunctionAssociationArray{}
+	if cfg.basicAuth != (BasicAuth{}) {
+		code, err := renderFunction("basic-auth.js", map[string]string{
+			"Credentials": base64.StdEncoding.EncodeToString([]byte(cfg.basicAuth.Username + ":" + cfg.basicAuth.Password)),
+			"Realm":       domain.name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		basicAuthFunction, err := cloudfront.NewFunction(ctx, fmt.Sprintf("%sBasicAuth", project.name), &cloudfront.FunctionArgs{
+			Name:    pulumi.String(fmt.Sprintf("%s-%s-basic-auth", project.name, environment.name)),
+			Runtime: pulumi.String("cloudfront-js-1.0"),
+			Comment: pulumi.String("Asks for HTTP basic auth credentials"),
+			Code:    pulumi.ToSecret(pulumi.String(code)).(pulumi.StringOutput),
+			Publish: pulumi.Bool(true),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultCacheBehavior.FunctionAssociations = cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArray{
+			&cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArgs{
+				EventType:   pulumi.String("viewer-request"),
+				FunctionArn: basicAuthFunction.Arn,
+			},
+		}
+		orderedFunctionAssociations = append(orderedFunctionAssociations, &cloudfront.DistributionOrderedCacheBehaviorFunctionAssociationArgs{
+			EventType:   pulumi.String("viewer-request"),
+			FunctionArn: basicAuthFunction.Arn,
+		})
+	}
+
+	// The canonical-link CloudFront Function names the canonical URL of
+	// each page in a Link header. It runs on the response, next to any
+	// function on the request.
+	if cfg.canonicalLinkHeader {
+		code, err := renderFunction("link-header.js", map[string]string{
+			"CanonicalUrl": cfg.canonicalUrl,
+		})
+		if err != nil {
+			return nil, err
+		}
+		linkHeaderFunction, err := cloudfront.NewFunction(ctx, fmt.Sprintf("%sCanonicalLink", project.name), &cloudfront.FunctionArgs{
+			Name:    pulumi.String(fmt.Sprintf("%s-%s-canonical-link", project.name, environment.name)),
+			Runtime: pulumi.String("cloudfront-js-1.0"),
+			Comment: pulumi.String("Adds a Link header with the canonical URL"),
+			Code:    pulumi.String(code),
+			Publish: pulumi.Bool(true),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		functionAssociations, _ := defaultCacheBehavior.FunctionAssociations.(cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArray)
+		defaultCacheBehavior.FunctionAssociations = append(functionAssociations, &cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArgs{
+			EventType:   pulumi.String("viewer-response"),
+			FunctionArn: linkHeaderFunction.Arn,
+		})
+		orderedFunctionAssociations = append(orderedFunctionAssociations, &cloudfront.DistributionOrderedCacheBehaviorFunctionAssociationArgs{
+			EventType:   pulumi.String("viewer-response"),
+			FunctionArn: linkHeaderFunction.Arn,
+		})
+	}
+
+	// The request-id CloudFront Function sets the `requestId.header` to
+	// the CloudFront request ID on the request and echoes it on the
+	// response. A response headers policy only sends fixed values.
+	if cfg.requestId.Enabled {
+		code, err := renderFunction("request-id.js", cfg.requestId)
+		if err != nil {
+			return nil, err
+		}
+		requestIdFunction, err := cloudfront.NewFunction(ctx, fmt.Sprintf("%sRequestId", project.name), &cloudfront.FunctionArgs{
+			Name:    pulumi.String(fmt.Sprintf("%s-%s-request-id", project.name, environment.name)),
+			Runtime: pulumi.String("cloudfront-js-1.0"),
+			Comment: pulumi.String("Tags requests and responses with the request ID"),
+			Code:    pulumi.String(code),
+			Publish: pulumi.Bool(true),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		functionAssociations := cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArray{}
+		for _, eventType := range []string{"viewer-request", "viewer-response"} {
+			functionAssociations = append(functionAssociations, &cloudfront.DistributionDefaultCacheBehaviorFunctionAssociationArgs{
+				EventType:   pulumi.String(eventType),
+				FunctionArn: requestIdFunction.Arn,
+			})
+			orderedFunctionAssociations = append(orderedFunctionAssociations, &cloudfront.DistributionOrderedCacheBehaviorFunctionAssociationArgs{
+				EventType:   pulumi.String(eventType),
+				FunctionArn: requestIdFunction.Arn,
+			})
+		}
+		defaultCacheBehavior.FunctionAssociations = functionAssociations
+	}
+
+	// Ordered cache behaviors are matched before the default one. Paths in
+	// `noCachePaths`, such as HTML entry points, are served with a TTL of
+	// zero so content updates show up straight away.
+	orderedCacheBehaviors := cloudfront.DistributionOrderedCacheBehaviorArray{}
+
+	// Private paths come first so that no other behavior can serve them
+	// without a signed URL or signed cookies from a trusted key group.
+	var publicKey *cloudfront.PublicKey
+	var keyGroup *cloudfront.KeyGroup
+	if cfg.privateContent.Enabled {
+		trustedKeyGroups := pulumi.ToStringArray(cfg.privateContent.KeyGroupIds)
+		if cfg.privateContent.PublicKey != "" {
+			publicKey, err = cloudfront.NewPublicKey(ctx, fmt.Sprintf("%sPublicKey", project.name), &cloudfront.PublicKeyArgs{
+				Name:       pulumi.String(fmt.Sprintf("%s-%s", project.name, environment.name)),
+				Comment:    pulumi.String("Verifies signed URLs and cookies for private content"),
+				EncodedKey: pulumi.String(cfg.privateContent.PublicKey),
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			keyGroup, err = cloudfront.NewKeyGroup(ctx, fmt.Sprintf("%sKeyGroup", project.name), &cloudfront.KeyGroupArgs{
+				Name:    pulumi.String(fmt.Sprintf("%s-%s", project.name, environment.name)),
+				Comment: pulumi.String("Signs URLs and cookies for private content"),
+				Items:   pulumi.StringArray{publicKey.ID()},
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			importMap[fmt.Sprintf("%sPublicKey", project.name)] = publicKey.ID()
+			importMap[fmt.Sprintf("%sKeyGroup", project.name)] = keyGroup.ID()
+			trustedKeyGroups = append(trustedKeyGroups, keyGroup.ID())
+		}
+		for _, pattern := range cfg.privateContent.PathPatterns {
+			orderedCacheBehaviors = append(orderedCacheBehaviors, &cloudfront.DistributionOrderedCacheBehaviorArgs{
+				PathPattern:    pulumi.String(pattern),
+				AllowedMethods: defaultCacheBehavior.AllowedMethods,
+				CachedMethods:  defaultCacheBehavior.CachedMethods,
+				TargetOriginId: bucket.ID(),
+				ForwardedValues: &cloudfront.DistributionOrderedCacheBehaviorForwardedValuesArgs{
+					QueryString: pulumi.Bool(false),
+					Cookies: &cloudfront.DistributionOrderedCacheBehaviorForwardedValuesCookiesArgs{
+						Forward: pulumi.String("none"),
+					},
+				},
+				ViewerProtocolPolicy: pulumi.String("redirect-to-https"),
+				MinTtl:               pulumi.Int(0),
+				DefaultTtl:           pulumi.Int(3600),
+				MaxTtl:               pulumi.Int(86400),
+				SmoothStreaming:      pulumi.Bool(false),
+				TrustedKeyGroups:     trustedKeyGroups,
+				RealtimeLogConfigArn: defaultCacheBehavior.RealtimeLogConfigArn,
+				FunctionAssociations: orderedFunctionAssociations,
+				Compress:             pulumi.Bool(cfg.compress),
+			})
+		}
+	}
+
+	for _, pattern := range cfg.noCachePaths {
+		orderedCacheBehaviors = append(orderedCacheBehaviors, &cloudfront.DistributionOrderedCacheBehaviorArgs{
+			PathPattern:    pulumi.String(pattern),
+			AllowedMethods: defaultCacheBehavior.AllowedMethods,
+			CachedMethods:  defaultCacheBehavior.CachedMethods,
+			TargetOriginId: bucket.ID(),
+			ForwardedValues: &cloudfront.DistributionOrderedCacheBehaviorForwardedValuesArgs{
+				QueryString: pulumi.Bool(false),
+				Cookies: &cloudfront.DistributionOrderedCacheBehaviorForwardedValuesCookiesArgs{
+					Forward: pulumi.String("none"),
+				},
+			},
+			ViewerProtocolPolicy: pulumi.String("redirect-to-https"),
+			MinTtl:               pulumi.Int(0),
+			DefaultTtl:           pulumi.Int(0),
+			MaxTtl:               pulumi.Int(0),
+			RealtimeLogConfigArn: defaultCacheBehavior.RealtimeLogConfigArn,
+			FunctionAssociations: orderedFunctionAssociations,
+			Compress:             pulumi.Bool(cfg.compress),
+		})
+	}
+
+	// Methods allowed on behaviors that accept writes, and on read only ones.
+	allMethods := pulumi.StringArray{
+		pulumi.String("GET"),
+		pulumi.String("HEAD"),
+		pulumi.String("OPTIONS"),
+		pulumi.String("PUT"),
+		pulumi.String("POST"),
+		pulumi.String("PATCH"),
+		pulumi.String("DELETE"),
+	}
+	readMethods := pulumi.StringArray{
+		pulumi.String("GET"),
+		pulumi.String("HEAD"),
+	}
+
+	// Requests for the API path are sent uncached to the API origin with
+	// every method, and every viewer header except Host, which API Gateway
+	// and most load balancers route on.
+	if cfg.apiOrigin.DomainName != "" {
+		orderedCacheBehaviors = append(orderedCacheBehaviors, &cloudfront.DistributionOrderedCacheBehaviorArgs{
+			PathPattern:           pulumi.String(cfg.apiOrigin.PathPattern),
+			AllowedMethods:        allMethods,
+			CachedMethods:         readMethods,
+			TargetOriginId:        pulumi.String("api"),
+			CachePolicyId:         pulumi.String(managedCachePolicies["CachingDisabled"]),
+			OriginRequestPolicyId: pulumi.String(managedOriginRequestPolicies["AllViewerExceptHostHeader"]),
+			ViewerProtocolPolicy:  pulumi.String("redirect-to-https"),
+			RealtimeLogConfigArn:  defaultCacheBehavior.RealtimeLogConfigArn,
+		})
+	}
+
+	// Preview requests of a headless CMS are never cached, as drafts change
+	// on every edit, and reach the preview origin with the cookies and
+	// headers it authenticates editors with.
+	if cfg.previewOrigin.DomainName != "" {
+		orderedCacheBehaviors = append(orderedCacheBehaviors, &cloudfront.DistributionOrderedCacheBehaviorArgs{
+			PathPattern:           pulumi.String(cfg.previewOrigin.PathPattern),
+			AllowedMethods:        allMethods,
+			CachedMethods:         readMethods,
+			TargetOriginId:        pulumi.String("preview"),
+			CachePolicyId:         pulumi.String(managedCachePolicies["CachingDisabled"]),
+			OriginRequestPolicyId: pulumi.String(managedOriginRequestPolicies["AllViewerExceptHostHeader"]),
+			ViewerProtocolPolicy:  pulumi.String("redirect-to-https"),
+			RealtimeLogConfigArn:  defaultCacheBehavior.RealtimeLogConfigArn,
+		})
+	}
+
+	// Each of the `routes` sends its path to one of the `origins` with the
+	// managed policies it names. Bucket routes are served like the rest of
+	// the website, custom origins as they are.
+	routeOrigins := []string{}
+	for _, route := range cfg.routes {
+		if !contains(routeOrigins, route.Origin) {
+			routeOrigins = append(routeOrigins, route.Origin)
+		}
+		behavior := &cloudfront.DistributionOrderedCacheBehaviorArgs{
+			PathPattern:          pulumi.String(route.PathPattern),
+			AllowedMethods:       readMethods,
+			CachedMethods:        readMethods,
+			TargetOriginId:       pulumi.String("origin-" + route.Origin),
+			CachePolicyId:        pulumi.String(route.cachePolicyId),
+			ViewerProtocolPolicy: pulumi.String("redirect-to-https"),
+			Compress:             pulumi.Bool(cfg.compress),
+			RealtimeLogConfigArn: defaultCacheBehavior.RealtimeLogConfigArn,
+		}
+		if route.Methods == "all" {
+			behavior.AllowedMethods = allMethods
+		}
+		if route.originRequestPolicyId != "" {
+			behavior.OriginRequestPolicyId = pulumi.String(route.originRequestPolicyId)
+		}
+		if cfg.origins[route.Origin].Type == "bucket" {
+			behavior.FunctionAssociations = orderedFunctionAssociations
+		}
+		orderedCacheBehaviors = append(orderedCacheBehaviors, behavior)
+	}
+
+	// Fingerprinted assets never change under the same key, so the paths in
+	// `immutableAssets` are cached at the edge for a year without
+	// revalidating with the bucket. Files that look fingerprinted but fall
+	// outside those paths, or the reverse, are reported as they would be
+	// cached for the wrong length of time.
+	if cfg.immutableAssets.Enabled {
+		for _, pattern := range cfg.immutableAssets.PathPatterns {
+			orderedCacheBehaviors = append(orderedCacheBehaviors, &cloudfront.DistributionOrderedCacheBehaviorArgs{
+				PathPattern:    pulumi.String(pattern),
+				AllowedMethods: defaultCacheBehavior.AllowedMethods,
+				CachedMethods:  defaultCacheBehavior.CachedMethods,
+				TargetOriginId: bucket.ID(),
+				ForwardedValues: &cloudfront.DistributionOrderedCacheBehaviorForwardedValuesArgs{
+					QueryString: pulumi.Bool(false),
+					Cookies: &cloudfront.DistributionOrderedCacheBehaviorForwardedValuesCookiesArgs{
+						Forward: pulumi.String("none"),
+					},
+				},
+				ViewerProtocolPolicy: pulumi.String("redirect-to-https"),
+				MinTtl:               pulumi.Int(cfg.immutableAssets.Ttl),
+				DefaultTtl:           pulumi.Int(cfg.immutableAssets.Ttl),
+				MaxTtl:               pulumi.Int(cfg.immutableAssets.Ttl),
+				RealtimeLogConfigArn: defaultCacheBehavior.RealtimeLogConfigArn,
+				FunctionAssociations: orderedFunctionAssociations,
+				Compress:             pulumi.Bool(cfg.compress),
+			})
+		}
+
+		outside, unhashed := 0, 0
+		for _, key := range keys {
+			matched := false
+			for _, pattern := range cfg.immutableAssets.PathPatterns {
+				if pathPatternMatch(pattern, mountPrefix+key) {
+					matched = true
+					break
+				}
+			}
+			if fingerprinted(key) && !matched {
+				outside++
+			}
+			if !fingerprinted(key) && matched {
+				unhashed++
+			}
+		}
+		if outside > 0 {
+			ctx.Log.Warn(fmt.Sprintf("immutableAssets: %d fingerprinted files are outside %v and use the default TTL", outside, cfg.immutableAssets.PathPatterns), nil)
+		}
+		if unhashed > 0 {
+			ctx.Log.Warn(fmt.Sprintf("immutableAssets: %d files in %v are not fingerprinted but will be cached for %d seconds", unhashed, cfg.immutableAssets.PathPatterns, cfg.immutableAssets.Ttl), nil)
+		}
+	}
+
+	// A 403 from the bucket, usually a missing object, is answered with
+	// the error document rather than the S3 AccessDenied XML, unless
+	// `customErrorResponses` maps it or `forbiddenErrorResponse` is none.
+	errorResponses := map[int]ErrorResponse{}
+	for code, er := range cfg.customErrorResponses {
+		errorResponses[code] = er
+	}
+	if _, ok := errorResponses[403]; !ok && cfg.forbiddenResponseCode != 0 && wb.errorDocument != "" && contains(keys, wb.errorDocument) {
+		errorResponses[403] = ErrorResponse{
+			Page:         "/" + wb.errorDocument,
+			ResponseCode: cfg.forbiddenResponseCode,
+		}
+	}
+
+	// Custom error responses in ascending status code order so the
+	// distribution config does not change between runs.
+	codes := []int{}
+	for code := range errorResponses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	customErrorResponses := cloudfront.DistributionCustomErrorResponseArray{}
+	for _, code := range codes {
+		er := errorResponses[code]
+		customErrorResponse := &cloudfront.DistributionCustomErrorResponseArgs{
+			ErrorCode: pulumi.Int(code),
+		}
+		if er.Page != "" {
+			customErrorResponse.ResponsePagePath = pulumi.String(cfg.mountPath + er.Page)
+			customErrorResponse.ResponseCode = pulumi.Int(code)
+		}
+		if er.ResponseCode != 0 {
+			customErrorResponse.ResponseCode = pulumi.Int(er.ResponseCode)
+		}
+		customErrorResponse.ErrorCachingMinTtl = pulumi.Int(cfg.errorDocumentTtl)
+		if er.Ttl != nil {
+			customErrorResponse.ErrorCachingMinTtl = pulumi.Int(*er.Ttl)
+		}
+		customErrorResponses = append(customErrorResponses, customErrorResponse)
+	}
+
+	// S3
+	// --
+	// Create a bucket policy that allows access to the bucket
+	// only from the CloudFront distribution.
+	originPrincipals := iam.GetPolicyDocumentStatementPrincipalArray{
+		&iam.GetPolicyDocumentStatementPrincipalArgs{
+			Type: pulumi.String("AWS"),
+			Identifiers: pulumi.StringArray{
+				originAccessId.IamArn,
+			},
+		},
+	}
+	policyStatements := iam.GetPolicyDocumentStatementArray{
+		&iam.GetPolicyDocumentStatementArgs{
+			Sid:        pulumi.String("1"),
+			Principals: originPrincipals,
+			Actions: pulumi.StringArray{
+				pulumi.String("s3:GetObject"),
+			},
+			Resources: pulumi.StringArray{
+				pulumi.Sprintf("%v/*", bucket.Arn),
+			},
+		},
+	}
+	// The objects of `deployLock` name the owner, so CloudFront may not
+	// read them.
+	if cfg.deployLock {
+		policyStatements = append(policyStatements, &iam.GetPolicyDocumentStatementArgs{
+			Sid:        pulumi.String("DenyDeployLock"),
+			Effect:     pulumi.String("Deny"),
+			Principals: originPrincipals,
+			Actions: pulumi.StringArray{
+				pulumi.String("s3:GetObject"),
+			},
+			Resources: pulumi.StringArray{
+				pulumi.Sprintf("%v/%s*", bucket.Arn, deployLockPrefix),
+			},
+		})
+	}
+	bucketPolicy := iam.GetPolicyDocumentOutput(ctx, iam.GetPolicyDocumentOutputArgs{
+		PolicyId:   pulumi.String("PolicyForCloudFrontPrivateContent"),
+		Version:    pulumi.String("2008-10-17"),
+		Statements: policyStatements,
+	}, invokeOpts...)
+
+	// Attach the bucket policy to the S3 Bucket. The policy is linted first
+	// so that wildcard actions or principals are flagged as warnings, or
+	// fail the deployment when `strictPolicyLint` is set.
+	// S3 rejects changes to the policy while the public access block of
+	// the bucket is changing, so they are made one after the other, and in
+	// the reverse order on destroy.
+	policyOpts := append([]pulumi.ResourceOption{pulumi.DependsOn([]pulumi.Resource{publicAccessBlock})}, opts...)
+	policy, err := s3.NewBucketPolicy(ctx, fmt.Sprintf("%sBucketPolicy", domain.name), &s3.BucketPolicyArgs{
+		Bucket: bucket.ID(),
+		Policy: bucketPolicy.ApplyT(func(bucketPolicy iam.GetPolicyDocumentResult) (string, error) {
+			findings, err := lintPolicy(bucketPolicy.Json)
+			if err != nil {
+				return "", err
+			}
+			for _, finding := range findings {
+				if cfg.strictPolicyLint {
+					return "", fmt.Errorf("bucket policy: %s", finding)
+				}
+				ctx.Log.Warn(fmt.Sprintf("bucket policy: %s", finding), nil)
+			}
+			return bucketPolicy.Json, nil
+		}).(pulumi.StringOutput),
+	}, policyOpts...)
+	if err != nil {
+		return nil, err
+	}
+	importMap[fmt.Sprintf("%sBucketPolicy", domain.name)] = policy.ID()
+
+	// Create a CloudFront Distribution. By default a single distribution
+	// serves every hostname. When `perHostRootObject` is configured, a
+	// distribution is created per hostname so each one can have its own
+	// default root object and origin path within the shared bucket.
+	//
+	// The distributions depend on the bucket policy and the objects, so
+	// that they are served as soon as a distribution is deployed, and so
+	// that `pulumi destroy` deletes the distributions before them.
+	distributionDeps := append([]pulumi.Resource{policy}, contentObjects...)
+	distributionOpts := append([]pulumi.ResourceOption{pulumi.DependsOn(distributionDeps)}, opts...)
+	if cfg.distributionWait != "" {
+		distributionOpts = append(distributionOpts, pulumi.Timeouts(&pulumi.CustomTimeouts{
+			Create: cfg.distributionWait,
+			Update: cfg.distributionWait,
+		}))
+	}
+	viewerCertificate := &cloudfront.DistributionViewerCertificateArgs{
+		CloudfrontDefaultCertificate: pulumi.Bool(false),
+		AcmCertificateArn:            certificateArn,
+		SslSupportMethod:             pulumi.String("sni-only"),
+		MinimumProtocolVersion:       pulumi.String("TLSv1.2_2021"),
+	}
+	if cfg.iamCertificateId != "" {
+		viewerCertificate.AcmCertificateArn = nil
+		viewerCertificate.IamCertificateId = pulumi.String(cfg.iamCertificateId)
+	}
+	newDistribution := func(name string, dist Distribution) (*cloudfront.Distribution, error) {
+		aliases := pulumi.StringArray{}
+		for _, alias := range dist.aliases {
+			aliases = append(aliases, pulumi.String(alias))
+		}
+		bucketOrigin := &cloudfront.DistributionOriginArgs{
+			DomainName: bucket.BucketRegionalDomainName,
+			OriginId:   bucket.ID(),
+			OriginPath: pulumi.String(dist.originPath),
+			S3OriginConfig: &cloudfront.DistributionOriginS3OriginConfigArgs{
+				OriginAccessIdentity: originAccessId.CloudfrontAccessIdentityPath,
+			},
+		}
+		// Only the website endpoint redirects, and it is served over HTTP
+		// only. Redirects need no access to the objects.
+		if cfg.externalRedirect != "" {
+			bucketOrigin.DomainName = bucket.WebsiteEndpoint
+			bucketOrigin.S3OriginConfig = nil
+			bucketOrigin.CustomOriginConfig = &cloudfront.DistributionOriginCustomOriginConfigArgs{
+				HttpPort:             pulumi.Int(80),
+				HttpsPort:            pulumi.Int(443),
+				OriginProtocolPolicy: pulumi.String("http-only"),
+				OriginSslProtocols:   pulumi.StringArray{pulumi.String("TLSv1.2")},
+			}
+		}
+		if cfg.originShield != "" {
+			bucketOrigin.OriginShield = &cloudfront.DistributionOriginOriginShieldArgs{
+				Enabled:            pulumi.Bool(true),
+				OriginShieldRegion: pulumi.String(cfg.originShield),
+			}
+		}
+		origins := cloudfront.DistributionOriginArray{bucketOrigin}
+		if cfg.apiOrigin.DomainName != "" {
+			origins = append(origins, &cloudfront.DistributionOriginArgs{
+				DomainName:    pulumi.String(cfg.apiOrigin.DomainName),
+				OriginId:      pulumi.String("api"),
+				CustomHeaders: originCustomHeaders(cfg.originCustomHeaders["api"]),
+				CustomOriginConfig: &cloudfront.DistributionOriginCustomOriginConfigArgs{
+					HttpPort:               pulumi.Int(80),
+					HttpsPort:              pulumi.Int(443),
+					OriginProtocolPolicy:   pulumi.String(cfg.apiOrigin.OriginProtocolPolicy),
+					OriginSslProtocols:     pulumi.StringArray{pulumi.String("TLSv1.2")},
+					OriginReadTimeout:      pulumi.Int(cfg.apiOrigin.ReadTimeout),
+					OriginKeepaliveTimeout: pulumi.Int(cfg.apiOrigin.KeepaliveTimeout),
+				},
+			})
+		}
+		if cfg.previewOrigin.DomainName != "" {
+			origins = append(origins, &cloudfront.DistributionOriginArgs{
+				DomainName:    pulumi.String(cfg.previewOrigin.DomainName),
+				OriginId:      pulumi.String("preview"),
+				CustomHeaders: originCustomHeaders(cfg.originCustomHeaders["preview"]),
+				CustomOriginConfig: &cloudfront.DistributionOriginCustomOriginConfigArgs{
+					HttpPort:             pulumi.Int(80),
+					HttpsPort:            pulumi.Int(443),
+					OriginProtocolPolicy: pulumi.String(cfg.previewOrigin.OriginProtocolPolicy),
+					OriginSslProtocols:   pulumi.StringArray{pulumi.String("TLSv1.2")},
+				},
+			})
+		}
+		for _, originName := range routeOrigins {
+			origin := cfg.origins[originName]
+			originArgs := &cloudfront.DistributionOriginArgs{
+				OriginId:      pulumi.String("origin-" + originName),
+				OriginPath:    pulumi.String(origin.OriginPath),
+				CustomHeaders: originCustomHeaders(cfg.originCustomHeaders[originName]),
+			}
+			switch {
+			case origin.Type == "custom":
+				originArgs.DomainName = pulumi.String(origin.DomainName)
+				originArgs.CustomOriginConfig = &cloudfront.DistributionOriginCustomOriginConfigArgs{
+					HttpPort:             pulumi.Int(80),
+					HttpsPort:            pulumi.Int(443),
+					OriginProtocolPolicy: pulumi.String(origin.OriginProtocolPolicy),
+					OriginSslProtocols:   pulumi.StringArray{pulumi.String("TLSv1.2")},
+				}
+			case origin.BucketName == "":
+				originArgs.DomainName = bucket.BucketRegionalDomainName
+			default:
+				originArgs.DomainName = pulumi.String(fmt.Sprintf("%s.s3.%s", origin.BucketName, args.partition.dnsSuffix))
+			}
+			if origin.Type == "bucket" {
+				originArgs.S3OriginConfig = &cloudfront.DistributionOriginS3OriginConfigArgs{
+					OriginAccessIdentity: originAccessId.CloudfrontAccessIdentityPath,
+				}
+			}
+			origins = append(origins, originArgs)
+		}
+		cloudFrontDist, err := cloudfront.NewDistribution(ctx, name, &cloudfront.DistributionArgs{
+			Origins:           origins,
+			Enabled:           pulumi.Bool(cfg.distributionEnabled),
+			HttpVersion:       pulumi.String("http2and3"),
+			IsIpv6Enabled:     pulumi.Bool(cfg.ipv6Enabled),
+			DefaultRootObject: pulumi.String(dist.rootObject),
+			// No logging config at the moment, this will be added as an
+			// option in the future
+			// LoggingConfig: &cloudfront.DistributionLoggingConfigArgs{
+			// 	IncludeCookies: pulumi.Bool(false),
+			// 	Bucket:         pulumi.String("mylogs.s3.amazonaws.com"),
+			// 	Prefix:         pulumi.String("myprefix"),
+			// },
+			Aliases:               aliases,
+			DefaultCacheBehavior:  defaultCacheBehavior,
+			OrderedCacheBehaviors: orderedCacheBehaviors,
+			CustomErrorResponses:  customErrorResponses,
+			PriceClass:            pulumi.String(priceClass),
+			Restrictions: &cloudfront.DistributionRestrictionsArgs{
+				GeoRestriction: &cloudfront.DistributionRestrictionsGeoRestrictionArgs{
+					// Set `geoRestriction` to enable Geo-Restrictions.
+					RestrictionType: pulumi.String(cfg.geoRestriction.Type),
+					Locations:       pulumi.ToStringArray(cfg.geoRestriction.Locations),
+				},
+			},
+			ViewerCertificate: viewerCertificate,
+			Tags:              resourceTags(dist.aliases[0], "distribution"),
+			// With waitFailureMode warn the provider does not wait, as it
+			// can not carry on after a timed out wait. The program waits
+			// for the deployment itself instead, see below.
+			WaitForDeployment: pulumi.Bool(cfg.waitFailureMode == "fail"),
+		}, distributionOpts...)
+		if err != nil {
+			return nil, err
+		}
+		importMap[name] = cloudFrontDist.ID()
+
+		// The additional CloudWatch metrics, such as the cache hit rate and
+		// error rates by status code, are billed per distribution.
+		if cfg.enhancedMetrics {
+			_, err = cloudfront.NewMonitoringSubscription(ctx, fmt.Sprintf("%sMonitoring", name), &cloudfront.MonitoringSubscriptionArgs{
+				DistributionId: cloudFrontDist.ID(),
+				MonitoringSubscription: &cloudfront.MonitoringSubscriptionMonitoringSubscriptionArgs{
+					RealtimeMetricsSubscriptionConfig: &cloudfront.MonitoringSubscriptionMonitoringSubscriptionRealtimeMetricsSubscriptionConfigArgs{
+						RealtimeMetricsSubscriptionStatus: pulumi.String("Enabled"),
+					},
+				},
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return cloudFrontDist, nil
+	}
+
+	// hostDists maps each hostname to the distribution that serves it.
+	hostDists := map[string]*cloudfront.Distribution{}
+	if len(cfg.perHostRootObject) == 0 {
+		// The root is redirected as it is, rather than as the index.
+		rootObject := wb.indexDocument
+		if cfg.externalRedirect != "" {
+			rootObject = ""
+		}
+		cloudFrontDist, err := newDistribution(fmt.Sprintf("%sDistribution", project.name), Distribution{
+			aliases:    hostnames,
+			rootObject: rootObject,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hostnames {
+			hostDists[host] = cloudFrontDist
+		}
+	} else {
+		for i, host := range hostnames {
+			dist := Distribution{
+				aliases:    []string{host},
+				rootObject: wb.indexDocument,
+			}
+			if hro, ok := cfg.perHostRootObject[host]; ok {
+				if hro.RootObject != "" {
+					dist.rootObject = hro.RootObject
+				}
+				dist.originPath = hro.OriginPath
+			}
+			cloudFrontDist, err := newDistribution(fmt.Sprintf("%s%sDistribution", hostPrefixes[i], project.name), dist)
+			if err != nil {
+				return nil, err
+			}
+			hostDists[host] = cloudFrontDist
+		}
+	}
+	lockDeps := append([]pulumi.Resource{}, contentObjects...)
+	for _, host := range hostnames {
+		lockDeps = append(lockDeps, hostDists[host])
+	}
+	if err := releaseLock(lockDeps); err != nil {
+		return nil, err
+	}
+
+	// With waitFailureMode warn the program polls CloudFront until every
+	// distribution is deployed, for up to `distributionWaitTimeout`, and
+	// warns with the last status seen when it is reached. The status of
+	// the apex distribution is exported as `distributionStatus`. Previews
+	// do not wait.
+	distributionStatus := hostDists[domain.name].Status
+	if cfg.waitFailureMode == "warn" && !ctx.DryRun() {
+		timeout := defaultDistributionWait
+		if cfg.distributionWait != "" {
+			timeout, _ = time.ParseDuration(cfg.distributionWait)
+		}
+		ids := []interface{}{hostDists[domain.name].ID()}
+		for _, host := range hostnames {
+			if hostDists[host] != hostDists[domain.name] {
+				ids = append(ids, hostDists[host].ID())
+			}
+		}
+		distributionStatus = pulumi.All(ids...).ApplyT(func(ids []interface{}) string {
+			deadline := time.Now().Add(timeout)
+			apexStatus := ""
+			for i, id := range ids {
+				status, err := waitDeployed(func() (string, error) {
+					dist, err := cloudfront.LookupDistribution(ctx, &cloudfront.LookupDistributionArgs{
+						Id: string(id.(pulumi.ID)),
+					}, invokeOpts...)
+					if err != nil {
+						return "", err
+					}
+					return dist.Status, nil
+				}, time.Until(deadline), distributionPollInterval, time.Sleep)
+				if err != nil {
+					ctx.Log.Warn(fmt.Sprintf("waitFailureMode: distribution %s %v", id, err), nil)
+				}
+				if i == 0 {
+					apexStatus = status
+				}
+			}
+			return apexStatus
+		}).(pulumi.StringOutput)
+	}
+
+	// CloudWatch
+	// ----------
+	// With `errorAlarm` each distribution gets an alarm on its 5xx error
+	// rate, which notifies an SNS topic that is created unless the ARN of
+	// an existing one is supplied. CloudFront publishes its metrics in
+	// us-east-1 with the `Global` region dimension, so the topic and alarms
+	// are created there.
+	var errorAlarm *cloudwatch.MetricAlarm
+	if cfg.errorAlarm.Enabled {
+		topicArn := pulumi.String(cfg.errorAlarm.SnsTopicArn).ToStringOutput()
+		if cfg.errorAlarm.SnsTopicArn == "" {
+			topic, err := sns.NewTopic(ctx, fmt.Sprintf("%sAlarmTopic", project.name), &sns.TopicArgs{
+				Tags: pulumi.ToStringMap(tags.tags),
+			}, certificateOpts...)
+			if err != nil {
+				return nil, err
+			}
+			topicArn = topic.Arn
+		}
+		alarmed := map[*cloudfront.Distribution]bool{}
+		for i, host := range hostnames {
+			if alarmed[hostDists[host]] {
+				continue
+			}
+			alarmed[hostDists[host]] = true
+			alarm, err := cloudwatch.NewMetricAlarm(ctx, fmt.Sprintf("%s%s5xxAlarm", hostPrefixes[i], project.name), &cloudwatch.MetricAlarmArgs{
+				AlarmDescription: pulumi.String(fmt.Sprintf("5xx error rate of the CloudFront distribution serving %s", host)),
+				Namespace:        pulumi.String("AWS/CloudFront"),
+				MetricName:       pulumi.String("5xxErrorRate"),
+				Dimensions: pulumi.StringMap{
+					"DistributionId": hostDists[host].ID(),
+					"Region":         pulumi.String("Global"),
+				},
+				Statistic:          pulumi.String("Average"),
+				Period:             pulumi.Int(60),
+				EvaluationPeriods:  pulumi.Int(cfg.errorAlarm.EvaluationPeriods),
+				Threshold:          pulumi.Float64(cfg.errorAlarm.Threshold),
+				ComparisonOperator: pulumi.String("GreaterThanThreshold"),
+				TreatMissingData:   pulumi.String("notBreaching"),
+				AlarmActions:       pulumi.Array{topicArn},
+				OkActions:          pulumi.Array{topicArn},
+				Tags:               pulumi.ToStringMap(tags.tags),
+			}, certificateOpts...)
+			if err != nil {
+				return nil, err
+			}
+			if errorAlarm == nil {
+				errorAlarm = alarm
+			}
+		}
+	}
+
+	// Create DNS records for the website.
+	// The A/AAAA records are alias records that point to the
+	// CloudFront distribution serving the hostname. Records are created
+	// for both the bare domain `example.domain` and the `www.example.domain`
+	// unless `recordType` is cname, in which case www gets a CNAME instead.
+	// `ipStack` chooses between A, AAAA or both, and `routingPolicy` how
+	// Route53 picks among records of other stacks for the same names.
+	recordTypes := map[string][]string{
+		"dual":   {"A", "AAAA"},
+		"v4only": {"A"},
+		"v6only": {"AAAA"},
+	}
+	for _, record := range recordTypes[cfg.ipStack] {
+		for i, host := range hostnames {
+			if hostPrefixes[i] == "www" && cfg.recordType == "cname" {
+				continue
+			}
+			name := fmt.Sprintf("%s%s%s", hostPrefixes[i], project.name, record)
+			recordArgs := &route53.RecordArgs{
+				ZoneId: zoneId,
+				Name:   pulumi.String(host),
+				Type:   pulumi.String(record),
+				Aliases: route53.RecordAliasArray{
+					&route53.RecordAliasArgs{
+						Name:                 hostDists[host].DomainName,
+						ZoneId:               hostDists[host].HostedZoneId,
+						EvaluateTargetHealth: pulumi.Bool(cfg.evaluateTargetHealth),
+					},
+				},
+			}
+			setRoutingPolicy(recordArgs, cfg.routingPolicy)
+			aliasRecord, err := route53.NewRecord(ctx, name, recordArgs, opts...)
+			if err != nil {
+				return nil, err
+			}
+			importMap[name] = aliasRecord.ID()
+			dnsRecords = append(dnsRecords, pulumi.Map{
+				"name":        aliasRecord.Name,
+				"type":        aliasRecord.Type,
+				"aliasTarget": hostDists[host].DomainName,
+			})
+		}
+	}
+	if cfg.recordType == "cname" {
+		host := hostnames[1]
+		name := fmt.Sprintf("%s%sCNAME", hostPrefixes[1], project.name)
+		recordArgs := &route53.RecordArgs{
+			ZoneId:  zoneId,
+			Name:    pulumi.String(host),
+			Type:    pulumi.String("CNAME"),
+			Records: pulumi.StringArray{hostDists[host].DomainName},
+			Ttl:     pulumi.Int(300),
+		}
+		setRoutingPolicy(recordArgs, cfg.routingPolicy)
+		cnameRecord, err := route53.NewRecord(ctx, name, recordArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+		importMap[name] = cnameRecord.ID()
+		dnsRecords = append(dnsRecords, pulumi.Map{
+			"name":  cnameRecord.Name,
+			"type":  cnameRecord.Type,
+			"value": hostDists[host].DomainName,
+		})
+	}
+
+	// Prewarm
+	// -------
+	// With `prewarm` the key pages are requested through the apex
+	// distribution by a local command, so the first viewers near the
+	// deploying machine are served from the edge cache. Only that one
+	// edge is warmed. The command runs once the distribution is deployed,
+	// its objects uploaded and the bucket readable, and again whenever the
+	// distribution ETag or an object changes. Failures are warnings, as the website is deployed
+	// either way.
+	var prewarmed pulumi.StringOutput
+	if cfg.prewarm.Enabled {
+		paths := cfg.prewarm.Paths
+		if len(paths) == 0 {
+			pages := []string{}
+			for _, key := range keys {
+				if !contains(errorPages, key) {
+					pages = append(pages, strings.TrimPrefix(objectKeys[key], mountPrefix))
+				}
+			}
+			paths = prewarmPaths(pages, cfg.prewarm.Limit)
+			for i := range paths {
+				paths[i] = cfg.mountPath + paths[i]
+			}
+		}
+		apexDist := hostDists[domain.name]
+		// The uploads complete in any order, so the ETags are combined
+		// in key order into one hash, which keeps the trigger stable.
+		etagKeys := make([]string, 0, len(uploadedEtags))
+		for key := range uploadedEtags {
+			etagKeys = append(etagKeys, key)
+		}
+		sort.Strings(etagKeys)
+		etags := make([]interface{}, len(etagKeys))
+		for i, key := range etagKeys {
+			etags[i] = uploadedEtags[key]
+		}
+		contentHash := pulumi.All(etags...).ApplyT(func(values []interface{}) string {
+			resolved := make([]string, len(values))
+			for i, v := range values {
+				resolved[i] = v.(string)
+			}
+			return etagsHash(etagKeys, resolved)
+		}).(pulumi.StringOutput)
+		triggers := pulumi.Array{apexDist.Etag, contentHash}
+		baseURL := pulumi.Sprintf("https://%s", apexDist.DomainName)
+		// The AWS provider in opts does not apply to the command.
+		prewarmDeps := append([]pulumi.Resource{apexDist, policy}, contentObjects...)
+		prewarmOpts := append([]pulumi.ResourceOption{pulumi.DependsOn(prewarmDeps)}, parentOpts...)
+		command, err := newPrewarmCommand(ctx, fmt.Sprintf("%sPrewarm", project.name), baseURL, paths, triggers, prewarmOpts...)
+		if err != nil {
+			return nil, err
+		}
+		prewarmed = command.Stdout.ApplyT(func(stdout string) string {
+			findings := prewarmFindings(stdout)
+			for _, finding := range findings {
+				ctx.Log.Warn(fmt.Sprintf("prewarm: %s", finding), nil)
+			}
+			return fmt.Sprintf("%d of %d paths", len(paths)-len(findings), len(paths))
+		}).(pulumi.StringOutput)
+	}
+
+	// Summarise the configured shape of the deployment so reviewers can
+	// confirm it from `pulumi preview` without reading the raw config.
+	certificateMode := "issued by ACM"
+	if existingCertificateArn != "" {
+		certificateMode = "existing " + existingCertificateArn
+	}
+	if cfg.iamCertificateId != "" {
+		certificateMode = "IAM server certificate " + cfg.iamCertificateId
+	}
+	bucketSummary := wb.name
+	if cfg.bucketNameSuffix == "random" {
+		bucketSummary += "-<random>"
+	}
+	distributions := 1
+	if len(cfg.perHostRootObject) > 0 {
+		distributions = len(hostnames)
+	}
+	summary := []string{
+		fmt.Sprintf("Hostnames: %s", strings.Join(hostnames, ", ")),
+		fmt.Sprintf("Files: %d uploaded, %d excluded", len(keys), skipped),
+		fmt.Sprintf("Bucket: %s", bucketSummary),
+		fmt.Sprintf("Certificate: %s", certificateMode),
+		fmt.Sprintf("DNS records: %s, %s", cfg.recordType, cfg.ipStack),
+		fmt.Sprintf("Distributions: %d, %s, %s", distributions, enabled(cfg.distributionEnabled), priceClass),
+		fmt.Sprintf("Query strings in cache key: %s", cfg.cacheQueryStrings),
+		fmt.Sprintf("No cache paths: %d", len(cfg.noCachePaths)),
+		fmt.Sprintf("Custom error responses: %d", len(errorResponses)),
+		fmt.Sprintf("CORS: %s", enabled(cfg.cors.Enabled)),
+		fmt.Sprintf("Basic auth: %s", enabled(cfg.basicAuth != (BasicAuth{}))),
+		fmt.Sprintf("Private content: %s", enabled(cfg.privateContent.Enabled)),
+		fmt.Sprintf("Real-time logs: %s", enabled(cfg.realtimeLogs.Enabled)),
+		fmt.Sprintf("Enhanced metrics: %s", enabled(cfg.enhancedMetrics)),
+		fmt.Sprintf("Gzip assets: %s", enabled(cfg.gzipAssets.Enabled)),
+		fmt.Sprintf("Transfer acceleration: %s", enabled(cfg.transferAcceleration)),
+		fmt.Sprintf("Object lock: %s", enabled(cfg.objectLock.Enabled)),
+	}
+
+	// Outputs are exported by the caller and shown in the terminal.
+	outputs := pulumi.Map{}
+	outputs["planSummary"] = pulumi.String(strings.Join(summary, "\n"))
+	outputs["bucketName"] = bucket.ID()
+	outputs["originAccessIdentityIamArn"] = originAccessId.IamArn
+	outputs["originAccessIdentityPath"] = originAccessId.CloudfrontAccessIdentityPath
+	outputs["cloudFrontDist"] = hostDists[domain.name].ID()
+	outputs["distributionStatus"] = distributionStatus
+	outputs["enhancedMetrics"] = pulumi.Bool(cfg.enhancedMetrics)
+	if errorAlarm != nil {
+		outputs["errorAlarmArn"] = errorAlarm.Arn
+	}
+	if cfg.prewarm.Enabled {
+		outputs["prewarmed"] = prewarmed
+	}
+	outputs["dnsRecords"] = dnsRecords
+	switch {
+	case cfg.iamCertificateId != "":
+		outputs["iamCertificateId"] = pulumi.String(cfg.iamCertificateId)
+	case existingCertificateArn != "":
+		outputs["certificateArn"] = certificateArn
+	default:
+		outputs["certificateArn"] = certificateArn
+		outputs["certificateStatus"] = certificateStatus
+	}
+	outputs["canonicalUrl"] = pulumi.String(cfg.canonicalUrl)
+	outputs["zoneId"] = zoneId
+	if createdZone != nil {
+		outputs["nameServers"] = createdZone.NameServers
+	}
+	if cfg.emitImportMap {
+		outputs["importMap"] = importMap.ToStringMapOutput().ApplyT(func(ids map[string]string) (string, error) {
+			b, err := json.MarshalIndent(ids, "", "  ")
+			return string(b), err
+		}).(pulumi.StringOutput)
+	}
+	if keyGroup != nil {
+		outputs["keyGroupId"] = keyGroup.ID()
+		outputs["publicKeyId"] = publicKey.ID()
+	}
+	if cfg.transferAcceleration {
+		outputs["accelerateEndpoint"] = pulumi.Sprintf("%s.s3-accelerate.%s", bucket.ID(), args.partition.dnsSuffix)
+	}
+	if len(cfg.perHostRootObject) > 0 && www {
+		outputs["wwwCloudFrontDist"] = hostDists[hostnames[1]].ID()
+	}
+	// The `monitoring` export gathers what dashboards and monitoring
+	// integrations need in one structure: each distribution with the
+	// namespace, region and dimensions of its CloudWatch metrics, and the
+	// bucket with those of its storage metrics.
+	monitoredDists := pulumi.Array{}
+	distHosts := map[*cloudfront.Distribution][]string{}
+	for _, host := range hostnames {
+		distHosts[hostDists[host]] = append(distHosts[hostDists[host]], host)
+	}
+	for _, host := range hostnames {
+		dist := hostDists[host]
+		if distHosts[dist][0] != host {
+			continue
+		}
+		monitoredDists = append(monitoredDists, pulumi.Map{
+			"id":         dist.ID(),
+			"arn":        dist.Arn,
+			"domainName": dist.DomainName,
+			"aliases":    pulumi.ToStringArray(distHosts[dist]),
+			"namespace":  pulumi.String("AWS/CloudFront"),
+			"region":     pulumi.String(args.partition.certificateRegion),
+			"dimensions": pulumi.Map{
+				"DistributionId": dist.ID(),
+				"Region":         pulumi.String("Global"),
+			},
+		})
+	}
+	monitoring := pulumi.Map{
+		"distributions":   monitoredDists,
+		"bucket":          bucketMonitoring(bucket),
+		"enhancedMetrics": pulumi.Bool(cfg.enhancedMetrics),
+	}
+	if cfg.realtimeLogs.Enabled {
+		monitoring["realtimeLogStreamArn"] = realtimeLogStreamArn
+	}
+	if errorAlarm != nil {
+		monitoring["errorAlarmArn"] = errorAlarm.Arn
+	}
+	if bucketMetric != nil {
+		outputs["bucketMetricName"] = bucketMetric.Name
+		monitoring["bucketMetric"] = bucketMetricMonitoring(bucket, bucketMetric)
+	}
+	outputs["monitoring"] = monitoring
+	if err := markSecretOutputs(ctx, cfg, outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// bucketMonitoring returns the bucket entry of the `monitoring` export,
+// with the dimensions of its daily storage metrics.
+func bucketMonitoring(bucket *s3.Bucket) pulumi.Map {
+	return pulumi.Map{
+		"name":      bucket.ID(),
+		"arn":       bucket.Arn,
+		"region":    bucket.Region,
+		"namespace": pulumi.String("AWS/S3"),
+		"dimensions": pulumi.Map{
+			"BucketName":  bucket.ID(),
+			"StorageType": pulumi.String("StandardStorage"),
+		},
+	}
+}
+
+// bucketMetricMonitoring returns the bucketMetric entry of the
+// `monitoring` export, with the dimensions of the request metrics.
+func bucketMetricMonitoring(bucket *s3.Bucket, metric *s3.BucketMetric) pulumi.Map {
+	return pulumi.Map{
+		"name":      metric.Name,
+		"namespace": pulumi.String("AWS/S3"),
+		"dimensions": pulumi.Map{
+			"BucketName": bucket.ID(),
+			"FilterId":   metric.Name,
+		},
+	}
+}
+
+// originCustomHeaders returns the custom headers of an origin in name
+// order, so the distribution config does not change between runs. The
+// values are usually shared secrets, so they are kept as secrets.
+func originCustomHeaders(headers map[string]string) cloudfront.DistributionOriginCustomHeaderArray {
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	customHeaders := cloudfront.DistributionOriginCustomHeaderArray{}
+	for _, name := range names {
+		customHeaders = append(customHeaders, &cloudfront.DistributionOriginCustomHeaderArgs{
+			Name:  pulumi.String(name),
+			Value: pulumi.ToSecret(pulumi.String(headers[name])).(pulumi.StringOutput),
+		})
+	}
+	return customHeaders
+}
+
+// setRoutingPolicy adds the routing policy of `routingPolicy` to a
+// website record.
+func setRoutingPolicy(record *route53.RecordArgs, p RoutingPolicy) {
+	if p.Type == "simple" {
+		return
+	}
+	record.SetIdentifier = pulumi.String(p.SetIdentifier)
+	switch p.Type {
+	case "latency":
+		record.LatencyRoutingPolicies = route53.RecordLatencyRoutingPolicyArray{
+			&route53.RecordLatencyRoutingPolicyArgs{
+				Region: pulumi.String(p.Region),
+			},
+		}
+	case "geolocation":
+		policy := &route53.RecordGeolocationRoutingPolicyArgs{}
+		if p.Continent != "" {
+			policy.Continent = pulumi.String(p.Continent)
+		}
+		if p.Country != "" {
+			policy.Country = pulumi.String(p.Country)
+		}
+		if p.Subdivision != "" {
+			policy.Subdivision = pulumi.String(p.Subdivision)
+		}
+		record.GeolocationRoutingPolicies = route53.RecordGeolocationRoutingPolicyArray{policy}
+	case "weighted":
+		record.WeightedRoutingPolicies = route53.RecordWeightedRoutingPolicyArray{
+			&route53.RecordWeightedRoutingPolicyArgs{
+				Weight: pulumi.Int(*p.Weight),
+			},
+		}
+	}
+}
+
+// markSecretOutputs replaces the outputs listed in `secretOutputs` with
+// secrets. Names that are not exported are warned about, or fail with
+// `strictValidation`.
+func markSecretOutputs(ctx *pulumi.Context, cfg Config, outputs pulumi.Map) error {
+	for _, name := range cfg.secretOutputs {
+		output, ok := outputs[name]
+		if !ok {
+			msg := fmt.Sprintf("secretOutputs: %q is not exported by this stack", name)
+			if cfg.strictValidation {
+				return errors.New(msg)
+			}
+			ctx.Log.Warn(msg, nil)
+			continue
+		}
+		outputs[name] = pulumi.ToSecret(output)
+	}
+	return nil
+}
+
+// wwwAlias reports whether the website is also served on the `www.`
+// variant of domain. By default it is only added for an apex domain, one
+// label below its public suffix, as `www.app.example.com` is rarely wanted.
+// Setting `wwwAlias` overrides the default either way.
+func wwwAlias(domain string, cfg configSource) (bool, error) {
+	apex, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return false, fmt.Errorf("%w: %q: %v", ErrInvalidDomain, domain, err)
+	}
+	return getBool(cfg, "wwwAlias", apex == domain)
+}
+
+// enabled describes a feature flag in the plan summary.
+func enabled(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// testPolicy is the bucket policy document the getPolicyDocument mock
+// returns, which passes the policy lint.
+const testPolicy = `{"Version":"2008-10-17","Statement":[{"Sid":"1","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::cloudfront:user/CloudFront Origin Access Identity E1"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::www.example.test/*"}]}`
+
+// siteMocks records the resources deploySite registers and answers its
+// lookups with a hosted zone and a policy document.
+type siteMocks struct {
+	mu        sync.Mutex
+	resources map[string]pulumi.MockResourceArgs
+}
+
+func (m *siteMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	outputs := args.Inputs.Copy()
+	switch args.TypeToken {
+	case "aws:s3/bucket:Bucket":
+		outputs["arn"] = resource.NewStringProperty("arn:aws:s3:::" + args.Name)
+		outputs["bucketRegionalDomainName"] = resource.NewStringProperty(args.Name + ".s3.us-east-1.amazonaws.com")
+		outputs["websiteEndpoint"] = resource.NewStringProperty(args.Name + ".s3-website-us-east-1.amazonaws.com")
+	case "aws:cloudfront/originAccessIdentity:OriginAccessIdentity":
+		outputs["iamArn"] = resource.NewStringProperty("arn:aws:iam::cloudfront:user/CloudFront Origin Access Identity E1")
+		outputs["cloudfrontAccessIdentityPath"] = resource.NewStringProperty("origin-access-identity/cloudfront/E1")
+	case "aws:acm/certificate:Certificate":
+		outputs["arn"] = resource.NewStringProperty("arn:aws:acm:us-east-1:123456789012:certificate/1")
+		options := []resource.PropertyValue{}
+		for _, name := range []string{"example.test", "www.example.test"} {
+			options = append(options, resource.NewObjectProperty(resource.PropertyMap{
+				"domainName":          resource.NewStringProperty(name),
+				"resourceRecordName":  resource.NewStringProperty("_x." + name + "."),
+				"resourceRecordType":  resource.NewStringProperty("CNAME"),
+				"resourceRecordValue": resource.NewStringProperty("_y.acm-validations.aws."),
+			}))
+		}
+		outputs["domainValidationOptions"] = resource.NewArrayProperty(options)
+	case "aws:cloudfront/distribution:Distribution":
+		outputs["arn"] = resource.NewStringProperty("arn:aws:cloudfront::123456789012:distribution/E2")
+		outputs["domainName"] = resource.NewStringProperty("d111111abcdef8.cloudfront.net")
+		outputs["hostedZoneId"] = resource.NewStringProperty("Z2FDTNDATAQYW2")
+		outputs["status"] = resource.NewStringProperty("Deployed")
+		outputs["etag"] = resource.NewStringProperty("E2ETAG")
+	case "command:local:Command":
+		outputs["stdout"] = resource.NewStringProperty("")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[args.Name] = args
+	return args.Name + "_id", outputs, nil
+}
+
+func (m *siteMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	switch args.Token {
+	case "aws:route53/getZone:getZone":
+		return resource.PropertyMap{
+			"zoneId":      resource.NewStringProperty("Z1"),
+			"name":        resource.NewStringProperty("example.test."),
+			"nameServers": resource.NewArrayProperty([]resource.PropertyValue{resource.NewStringProperty("ns-1.awsdns-01.org")}),
+		}, nil
+	case "aws:iam/getPolicyDocument:getPolicyDocument":
+		return resource.PropertyMap{"json": resource.NewStringProperty(testPolicy)}, nil
+	}
+	return resource.PropertyMap{}, nil
+}
+
+// emptyConfig is a stack configuration with nothing set.
+type emptyConfig struct{}
+
+func (emptyConfig) Get(string) string                   { return "" }
+func (emptyConfig) GetObject(string, interface{}) error { return nil }
+
+// testArgs returns the arguments of the website named project with the
+// settings in overrides.
+func testArgs(t *testing.T, project string, overrides map[string]interface{}) StaticSiteArgs {
+	t.Helper()
+	config := siteConfig{overrides: map[string]json.RawMessage{}, stack: emptyConfig{}}
+	for key, value := range overrides {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.overrides[key] = raw
+	}
+	return StaticSiteArgs{
+		project:     Project{name: project},
+		environment: Environment{name: "dev"},
+		site: Site{files: fstest.MapFS{
+			"index.html": &fstest.MapFile{Data: []byte("<p>home</p>")},
+			"error.html": &fstest.MapFile{Data: []byte("<p>error</p>")},
+		}},
+		domain:     Domain{name: "example.test"},
+		tags:       Tags{tags: map[string]string{"project": project, "environment": "dev"}},
+		priceClass: "PriceClass_100",
+		partition:  Partition{name: "aws", dnsSuffix: "amazonaws.com", certificateRegion: "us-east-1"},
+		config:     config,
+	}
+}
+
+// testSite deploys the website with the settings in overrides against
+// mocks, and returns the registered resources and the outputs.
+func testSite(t *testing.T, overrides map[string]interface{}) (map[string]pulumi.MockResourceArgs, pulumi.Map) {
+	t.Helper()
+	args := testArgs(t, "test", overrides)
+	mocks := &siteMocks{resources: map[string]pulumi.MockResourceArgs{}}
+	var outputs pulumi.Map
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		staticSite, err := NewStaticSite(ctx, "test", args)
+		if err != nil {
+			return err
+		}
+		outputs = staticSite.Outputs
+		return nil
+	}, pulumi.WithMocks("test", "dev", mocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mocks.resources, outputs
+}
+
+// errorResponses returns the custom error responses of the distribution,
+// keyed by error code.
+func errorResponses(t *testing.T, dist pulumi.MockResourceArgs) map[float64]resource.PropertyMap {
+	t.Helper()
+	responses := map[float64]resource.PropertyMap{}
+	if v, ok := dist.Inputs["customErrorResponses"]; ok {
+		for _, item := range v.ArrayValue() {
+			er := item.ObjectValue()
+			responses[er["errorCode"].NumberValue()] = er
+		}
+	}
+	return responses
+}
+
+func TestForbiddenErrorResponse(t *testing.T) {
+	resources, _ := testSite(t, nil)
+	er, ok := errorResponses(t, resources["testDistribution"])[403]
+	if !ok {
+		t.Fatal("no custom error response for 403")
+	}
+	if got := er["responsePagePath"].StringValue(); got != "/error.html" {
+		t.Errorf("403 responsePagePath = %q, want /error.html", got)
+	}
+	if got := er["responseCode"].NumberValue(); got != 404 {
+		t.Errorf("403 responseCode = %v, want 404", got)
+	}
+
+	resources, _ = testSite(t, map[string]interface{}{"forbiddenErrorResponse": "none"})
+	if _, ok := errorResponses(t, resources["testDistribution"])[403]; ok {
+		t.Error("custom error response for 403 with forbiddenErrorResponse none")
+	}
+}
+
+func TestSecretOutputs(t *testing.T) {
+	resources, outputs := testSite(t, map[string]interface{}{
+		"basicAuth":     map[string]string{"username": "staging", "password": "hunter2"},
+		"secretOutputs": []string{"bucketName", "cloudFrontDist"},
+	})
+
+	// The basic-auth function code embeds the credentials.
+	code := resources["testBasicAuth"].Inputs["code"]
+	if !code.IsSecret() {
+		t.Error("basic-auth function code is not a secret")
+	}
+	for _, name := range []string{"bucketName", "cloudFrontDist"} {
+		if !isSecret(outputs[name]) {
+			t.Errorf("output %s is not a secret", name)
+		}
+	}
+	if isSecret(outputs["zoneId"]) {
+		t.Error("output zoneId is a secret without being listed in secretOutputs")
+	}
+}
+
+// isSecret waits for input to resolve and reports whether it is a secret.
+func isSecret(input pulumi.Input) bool {
+	output := pulumi.ToOutput(input)
+	resolved := make(chan struct{})
+	output.ApplyT(func(v interface{}) interface{} {
+		close(resolved)
+		return v
+	})
+	<-resolved
+	return pulumi.IsSecret(output)
+}
+
+// dependsOn reports whether r depends on the resource named name.
+func dependsOn(r pulumi.MockResourceArgs, name string) bool {
+	for _, urn := range r.RegisterRPC.GetDependencies() {
+		if strings.HasSuffix(urn, "::"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestDestroyOrder checks the dependency edges `pulumi destroy` deletes
+// the resources in the reverse order of: the records before the
+// distribution, the distribution before the objects and the bucket
+// policy, and those before the origin access identity and the bucket.
+func TestDestroyOrder(t *testing.T) {
+	resources, _ := testSite(t, nil)
+	edges := []struct {
+		from string
+		to   []string
+	}{
+		{"testA", []string{"testDistribution"}},
+		{"wwwtestAAAA", []string{"testDistribution"}},
+		{"testDistribution", []string{"example.testBucketPolicy", "index.html", "error.html", "testOriginAccessId", "testBucket"}},
+		{"example.testBucketPolicy", []string{"testBucketNoPublic", "testOriginAccessId", "testBucket"}},
+		{"index.html", []string{"testBucket"}},
+		{"error.html", []string{"testBucket"}},
+	}
+	for _, edge := range edges {
+		r, ok := resources[edge.from]
+		if !ok {
+			t.Fatalf("resource %s not registered", edge.from)
+		}
+		for _, to := range edge.to {
+			if !dependsOn(r, to) {
+				t.Errorf("%s does not depend on %s", edge.from, to)
+			}
+		}
+	}
+}
+
+func TestPrewarmCommand(t *testing.T) {
+	resources, outputs := testSite(t, map[string]interface{}{
+		"prewarm": map[string]interface{}{"enabled": true},
+	})
+	command, ok := resources["testPrewarm"]
+	if !ok {
+		t.Fatal("prewarm command not registered")
+	}
+	if command.TypeToken != "command:local:Command" {
+		t.Errorf("prewarm type = %s, want command:local:Command", command.TypeToken)
+	}
+	triggers := command.Inputs["triggers"].ArrayValue()
+	if len(triggers) != 2 || triggers[0].StringValue() != "E2ETAG" {
+		t.Errorf("prewarm triggers = %v, want the distribution ETag and the content hash", triggers)
+	}
+	create := command.Inputs["create"].StringValue()
+	if !strings.Contains(create, "'https://d111111abcdef8.cloudfront.net'") {
+		t.Errorf("prewarm script does not request the distribution domain:\n%s", create)
+	}
+	for _, name := range []string{"testDistribution", "example.testBucketPolicy", "index.html"} {
+		if !dependsOn(command, name) {
+			t.Errorf("prewarm command does not depend on %s", name)
+		}
+	}
+	prewarmed := make(chan string)
+	pulumi.ToOutput(outputs["prewarmed"]).ApplyT(func(v interface{}) interface{} {
+		prewarmed <- v.(string)
+		return v
+	})
+	if got := <-prewarmed; got != "1 of 1 paths" {
+		t.Errorf("prewarmed = %q, want 1 of 1 paths", got)
+	}
+}
+
+func TestDeployLockRelease(t *testing.T) {
+	resources, _ := testSite(t, map[string]interface{}{"deployLock": true})
+	release, ok := resources["testDeployLockRelease"]
+	if !ok {
+		t.Fatal("deploy lock release not registered")
+	}
+	if got, want := release.Inputs["content"], resources["testDeployLock"].Inputs["content"]; got.StringValue() != want.StringValue() {
+		t.Errorf("release content = %v, want the lock content %v", got, want)
+	}
+	for _, name := range []string{"testDeployLock", "testDistribution", "index.html", "error.html"} {
+		if !dependsOn(release, name) {
+			t.Errorf("deploy lock release does not depend on %s", name)
+		}
+	}
+
+	// The lock only changes with the content, so a second deployment of
+	// the same site does not rewrite it.
+	again, _ := testSite(t, map[string]interface{}{"deployLock": true})
+	if got, want := again["testDeployLock"].Inputs["content"].StringValue(), resources["testDeployLock"].Inputs["content"].StringValue(); got != want {
+		t.Errorf("lock content changed between deployments: %s != %s", got, want)
+	}
+}
+
+func TestStaticSiteParent(t *testing.T) {
+	resources, _ := testSite(t, nil)
+	component, ok := resources["test"]
+	if !ok {
+		t.Fatal("StaticSite component not registered")
+	}
+	if component.TypeToken != "stratuslabs:website:StaticSite" || component.Custom {
+		t.Errorf("component = %s custom %v, want the StaticSite component resource", component.TypeToken, component.Custom)
+	}
+	for name, r := range resources {
+		if name == "test" {
+			continue
+		}
+		if parent := r.RegisterRPC.GetParent(); !strings.HasSuffix(parent, "stratuslabs:website:StaticSite::test") {
+			t.Errorf("%s has parent %q, want the StaticSite component", name, parent)
+		}
+		if aliases := r.RegisterRPC.GetAliases(); len(aliases) == 0 {
+			t.Errorf("%s has no alias to its URN without a parent", name)
+		}
+	}
+}
+
+func TestSharedCertificateProvider(t *testing.T) {
+	mocks := &siteMocks{resources: map[string]pulumi.MockResourceArgs{}}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		provider, err := aws.NewProvider(ctx, "certificates", &aws.ProviderArgs{
+			Region: pulumi.String("us-east-1"),
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"a", "b"} {
+			args := testArgs(t, "test-"+name, nil)
+			args.objectPrefix = name + "/"
+			args.certificateProvider = provider
+			if _, err := NewStaticSite(ctx, "test-"+name, args); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, pulumi.WithMocks("test", "dev", mocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test-aCert", "test-bCert"} {
+		cert, ok := mocks.resources[name]
+		if !ok {
+			t.Fatalf("certificate %s not registered", name)
+		}
+		if !strings.Contains(cert.Provider, "pulumi:providers:aws::certificates::") {
+			t.Errorf("certificate %s has provider %q, want the shared certificates provider", name, cert.Provider)
+		}
+	}
+	providers := 0
+	for _, r := range mocks.resources {
+		if r.TypeToken == "pulumi:providers:aws" {
+			providers++
+		}
+	}
+	if providers != 1 {
+		t.Errorf("%d AWS providers registered, want the one shared provider", providers)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// readTagsFile reads a JSON or YAML file holding a single object of tag
+// keys to values. JSON is read as YAML, of which it is a subset. Values
+// must be strings, so numbers and booleans have to be quoted.
+func readTagsFile(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	parsed := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	tags := map[string]string{}
+	invalid := []string{}
+	for key, value := range parsed {
+		s, ok := value.(string)
+		if !ok {
+			invalid = append(invalid, key)
+			continue
+		}
+		tags[key] = s
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return nil, fmt.Errorf("%s: values of %s must be strings", name, strings.Join(invalid, ", "))
+	}
+	return tags, nil
+}
+
+// validTag reports whether key and value can be used as an AWS tag.
+func validTag(key, value string) bool {
+	return key != "" && len(key) <= 128 && len(value) <= 256 && !strings.HasPrefix(strings.ToLower(key), "aws:")
+}
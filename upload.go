@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// siteFiles walks fsys and returns the object key of every file that does
+// not match one of the exclude patterns, along with the number of files
+// that were skipped. Keys are relative to the root of fsys and always use
+// '/'.
+func siteFiles(fsys fs.FS, exclude []string) ([]string, int, error) {
+	keys := []string{}
+	skipped := 0
+	err := fs.WalkDir(fsys, ".", func(key string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if excluded(key, exclude) {
+			skipped++
+			return nil
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, skipped, err
+}
+
+// cleanUrlKeys maps every key in keys to the object key it is uploaded
+// as. With clean set, an HTML page such as `about.html` is uploaded as the
+// directory index `about/index.html`, apart from index documents and the
+// keys in keep. An error is returned when two files map to the same key.
+func cleanUrlKeys(keys []string, clean bool, keep []string) (map[string]string, error) {
+	objectKeys := map[string]string{}
+	sources := map[string]string{}
+	for _, key := range keys {
+		objectKey := key
+		if clean && path.Ext(key) == ".html" && path.Base(key) != "index.html" && !contains(keep, key) {
+			objectKey = strings.TrimSuffix(key, ".html") + "/index.html"
+		}
+		if source, ok := sources[objectKey]; ok {
+			return nil, fmt.Errorf("%s and %s would both be uploaded as %s", source, key, objectKey)
+		}
+		sources[objectKey] = key
+		objectKeys[key] = objectKey
+	}
+	return objectKeys, nil
+}
+
+// directoryKey returns the key of the directory holding the directory
+// index objectKey, such as `blog/` for `blog/index.html`, or "" when
+// objectKey is not the index of a subdirectory.
+func directoryKey(objectKey string) string {
+	if path.Base(objectKey) != "index.html" || !strings.Contains(objectKey, "/") {
+		return ""
+	}
+	return strings.TrimSuffix(objectKey, "index.html")
+}
+
+// contentLanguage returns the language of key, from the longest of the
+// prefixes in languages that key starts with, or "" when none match.
+func contentLanguage(key string, languages map[string]string) string {
+	match := ""
+	for prefix := range languages {
+		if strings.HasPrefix(key, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	return languages[match]
+}
+
+// excluded reports whether key matches any of the patterns.
+func excluded(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchKey(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchKey reports whether key matches pattern. Patterns containing a '/'
+// are matched against the whole key, all others against the file name
+// only so that `*.map` applies in every directory.
+func matchKey(pattern, key string) bool {
+	name := path.Base(key)
+	if strings.Contains(pattern, "/") {
+		name = key
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// fingerprintRe matches file names carrying a content hash, such as
+// `app.3f9a1c2b.js` or `logo-9c1d7e6f0a.svg`, as produced by asset bundlers.
+var fingerprintRe = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[A-Za-z0-9]+$`)
+
+// fingerprinted reports whether the file name of key carries a content hash.
+func fingerprinted(key string) bool {
+	return fingerprintRe.MatchString(path.Base(key))
+}
+
+// pathPatternMatch reports whether the object key is matched by the
+// CloudFront path pattern, where `*` matches any run of characters,
+// including `/`, and `?` matches exactly one.
+func pathPatternMatch(pattern, key string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	ok, _ := regexp.MatchString(re.String(), "/"+key)
+	return ok
+}
+
+// storageClass returns the storage class for key. When several patterns
+// match, the longest one wins as it is the most specific.
+func storageClass(key string, classes map[string]string) string {
+	class, longest := "STANDARD", -1
+	for pattern, c := range classes {
+		if len(pattern) > longest && matchKey(pattern, key) {
+			class, longest = c, len(pattern)
+		}
+	}
+	return class
+}
+
+// cacheControl returns the Cache-Control header for key from the
+// `cacheControl` extensions, or "" to leave it unset.
+func cacheControl(key string, values map[string]string) string {
+	return values[strings.ToLower(path.Ext(key))]
+}
+
+// contentTypes maps file extensions to the Content-Type objects are
+// uploaded with. It is kept here, rather than read from the system MIME
+// database, so that every machine uploads with the same types.
+var contentTypes = map[string]string{
+	".avif":        "image/avif",
+	".css":         "text/css; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".eot":         "application/vnd.ms-fontobject",
+	".gif":         "image/gif",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/x-icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".mp4":         "video/mp4",
+	".otf":         "font/otf",
+	".pdf":         "application/pdf",
+	".png":         "image/png",
+	".rss":         "application/rss+xml",
+	".svg":         "image/svg+xml",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".webm":        "video/webm",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".xml":         "application/xml",
+}
+
+// wellKnownContentTypes maps the files under `.well-known/` that have no
+// extension to their Content-Type.
+var wellKnownContentTypes = map[string]string{
+	"apple-app-site-association": "application/json",
+}
+
+// contentType returns the Content-Type for the object key. Files under
+// `.well-known/` without an extension are plain text unless listed in
+// wellKnownContentTypes, and other files without an extension are served
+// as HTML pages.
+func contentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	if ext == "" {
+		if strings.HasPrefix(key, ".well-known/") {
+			if ct, ok := wellKnownContentTypes[path.Base(key)]; ok {
+				return ct
+			}
+			return "text/plain; charset=utf-8"
+		}
+		return "text/html; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// uploadFiles calls upload for every key in keys, running at most
+// concurrency calls at a time. When every is positive, progress is called
+// after every that many calls succeed and after the last one, with the
+// number of successful calls. The first error returned by upload is
+// returned once all in-flight calls have finished.
+func uploadFiles(keys []string, concurrency int, every int, progress func(done int), upload func(key string) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     int
+	)
+	sem := make(chan struct{}, concurrency)
+
+	for _, key := range keys {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := upload(key)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			done++
+			if every > 0 && (done%every == 0 || done == len(keys)) {
+				progress(done)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// gzipEligible reports whether the file with the given key and size should
+// be compressed before upload.
+func gzipEligible(key string, size int64, g GzipAssets) bool {
+	if !g.Enabled || size < g.MinSize {
+		return false
+	}
+	return contains(g.Extensions, strings.ToLower(path.Ext(key)))
+}
+
+// gzipFile returns the base64 encoded gzip of the file key in fsys. The
+// gzip header carries no name or timestamp, so the output only changes when
+// the file content does.
+func gzipFile(fsys fs.FS, key string) (string, error) {
+	f, err := fsys.Open(key)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(zw, f); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// readFile returns the base64 encoded content of the file key in fsys, for
+// files that are not on disk and so can not be uploaded as a file asset.
+func readFile(fsys fs.FS, key string) (string, error) {
+	b, err := fs.ReadFile(fsys, key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// fileHash returns the hash of the file key in fsys used to tell when it
+// changed. The sha256 algorithm returns the hex encoded SHA256 of the
+// file. The etag algorithm returns the ETag S3 gives the object: the MD5
+// of a file smaller than partSize bytes, otherwise the MD5 of the MD5s of
+// its parts followed by the number of parts, as the AWS CLI uploads files
+// of partSize bytes or more in parts.
+func fileHash(fsys fs.FS, key string, algorithm string, partSize int64) (string, error) {
+	f, err := fsys.Open(key)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if algorithm != "etag" {
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	parts := md5.New()
+	count := 0
+	var last []byte
+	var size int64
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, f, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n == 0 && count > 0 {
+			break
+		}
+		size += n
+		last = h.Sum(nil)
+		parts.Write(last)
+		count++
+		if n < partSize {
+			break
+		}
+	}
+	if size < partSize {
+		return hex.EncodeToString(last), nil
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(parts.Sum(nil)), count), nil
+}
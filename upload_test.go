@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestUploadFilesFirstError(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	errB := errors.New("b failed")
+	var calls int32
+	err := uploadFiles(keys, 1, 0, nil, func(key string) error {
+		atomic.AddInt32(&calls, 1)
+		if key == "b" {
+			return errB
+		}
+		if key == "d" {
+			return errors.New("d failed")
+		}
+		return nil
+	})
+	if !errors.Is(err, errB) {
+		t.Fatalf("uploadFiles() error = %v, want %v", err, errB)
+	}
+	// With a single worker no key is started once b has failed, apart
+	// from the one already waiting for the worker.
+	if calls > 3 {
+		t.Errorf("upload called %d times after the first error, want at most 3", calls)
+	}
+}
+
+func TestUploadFilesProgress(t *testing.T) {
+	tests := []struct {
+		keys  int
+		every int
+		want  []int
+	}{
+		{keys: 10, every: 5, want: []int{5, 10}},
+		{keys: 7, every: 3, want: []int{3, 6, 7}},
+		{keys: 2, every: 5, want: []int{2}},
+		{keys: 4, every: 0, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d every %d", tt.keys, tt.every), func(t *testing.T) {
+			keys := make([]string, tt.keys)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("file%d", i)
+			}
+			var got []int
+			err := uploadFiles(keys, 4, tt.every, func(done int) {
+				got = append(got, done)
+			}, func(string) error { return nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("progress called with %v, want %v", got, tt.want)
+			}
+			if tt.every > 0 && got[len(got)-1] != len(keys) {
+				t.Errorf("last progress = %d, want len(keys) %d", got[len(got)-1], len(keys))
+			}
+		})
+	}
+}
+
+// largeSite returns a site of n files of size bytes each.
+func largeSite(n, size int) (fstest.MapFS, []string) {
+	fsys := fstest.MapFS{}
+	keys := make([]string, n)
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	for i := range keys {
+		keys[i] = fmt.Sprintf("assets/%04d.js", i)
+		fsys[keys[i]] = &fstest.MapFile{Data: data}
+	}
+	return fsys, keys
+}
+
+func BenchmarkUploadFiles(b *testing.B) {
+	fsys, keys := largeSite(2000, 64<<10)
+	for _, concurrency := range []int{1, 4, 10, 32} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := uploadFiles(keys, concurrency, 0, nil, func(key string) error {
+					_, err := fileHash(fsys, key, "sha256", int64(defaultEtagPartSize)<<20)
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileHash(t *testing.T) {
+	data := []byte("0123456789abcdef")
+	tests := []struct {
+		name      string
+		size      int
+		algorithm string
+		want      string
+	}{
+		{"empty etag", 0, "etag", "d41d8cd98f00b204e9800998ecf8427e"},
+		{"single part", 3, "etag", "d2490f048dc3b77a457e3e450ab4eb38"},
+		{"size == partSize", 4, "etag", "93f7350231d1aef318afd2b3feccfec4-1"},
+		{"size == 2*partSize", 8, "etag", "6f6e3a73411a3a634c335e478a2fe8f1-2"},
+		{"partial last part", 9, "etag", "61f137cda3ed3d5674f8b1d424e102d2-3"},
+		{"empty sha256", 0, "sha256", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"sha256", 9, "sha256", "36f50957f5e0b6ee3ef455674da35a86667f3314209dc1514c510fe95e840831"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{"file": &fstest.MapFile{Data: data[:tt.size]}}
+			got, err := fileHash(fsys, "file", tt.algorithm, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("fileHash() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirectoryKey(t *testing.T) {
+	tests := []struct {
+		objectKey string
+		want      string
+	}{
+		{"blog/index.html", "blog/"},
+		{"a/b/index.html", "a/b/"},
+		{"index.html", ""},
+		{"blog/post.html", ""},
+		{"blog/index.htm", ""},
+		{"assets/app.js", ""},
+		{"blog/myindex.html", ""},
+	}
+	for _, tt := range tests {
+		if got := directoryKey(tt.objectKey); got != tt.want {
+			t.Errorf("directoryKey(%q) = %q, want %q", tt.objectKey, got, tt.want)
+		}
+	}
+}
+
+func TestSiteFilesWellKnown(t *testing.T) {
+	keys, skipped, err := siteFiles(os.DirFS("testdata"), defaultExcludePatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 0 || !contains(keys, ".well-known/security.txt") {
+		t.Errorf("siteFiles() = %v, skipped %d, want .well-known/security.txt uploaded", keys, skipped)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{".well-known/security.txt", "text/plain; charset=utf-8"},
+		{"index.html", "text/html; charset=utf-8"},
+		{"about", "text/html; charset=utf-8"},
+		{"assets/site.css", "text/css; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		if got := contentType(tt.key); got != tt.want {
+			t.Errorf("contentType(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultDistributionWait bounds the wait for a distribution deployment
+// when `distributionWaitTimeout` is not set, matching the create timeout
+// of the AWS provider.
+const defaultDistributionWait = 70 * time.Minute
+
+// distributionPollInterval is the time between two status lookups while
+// waiting for a distribution deployment.
+const distributionPollInterval = 30 * time.Second
+
+// waitDeployed calls status until it reports `Deployed`, or until timeout
+// has passed, and returns the last status seen. An error is returned when
+// the timeout is reached first, naming that status.
+func waitDeployed(status func() (string, error), timeout, interval time.Duration, sleep func(time.Duration)) (string, error) {
+	last := "unknown"
+	for waited := time.Duration(0); ; waited += interval {
+		current, err := status()
+		if err == nil {
+			last = current
+			if current == "Deployed" {
+				return last, nil
+			}
+		}
+		if waited+interval > timeout {
+			if err != nil {
+				return last, fmt.Errorf("not deployed after %s, last status %s: %w", timeout, last, err)
+			}
+			return last, fmt.Errorf("not deployed after %s, last status %s", timeout, last)
+		}
+		sleep(interval)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitDeployed(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		timeout  time.Duration
+		want     string
+		wantErr  bool
+	}{
+		{"deployed", []string{"Deployed"}, time.Minute, "Deployed", false},
+		{"deployed after polling", []string{"InProgress", "InProgress", "Deployed"}, time.Minute, "Deployed", false},
+		{"timeout", []string{"InProgress", "InProgress", "InProgress", "InProgress"}, time.Minute, "InProgress", true},
+		{"lookup error", []string{""}, 0, "unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			status := func() (string, error) {
+				s := tt.statuses[calls]
+				calls++
+				if s == "" {
+					return "", errors.New("throttled")
+				}
+				return s, nil
+			}
+			got, err := waitDeployed(status, tt.timeout, 30*time.Second, func(time.Duration) {})
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("waitDeployed() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}